@@ -0,0 +1,145 @@
+// Copyright 2024 by Jonathan Amsterdam.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+// Gdlfmt formats gdl files.
+//
+// Usage:
+//
+//	gdlfmt [flags] [path ...]
+//
+// With no paths, gdlfmt formats standard input. A path that is a directory
+// is searched recursively for files ending in ".gdl".
+// By default, gdlfmt prints the formatted files to standard output.
+//
+// The flags are:
+//
+//	-d
+//		Do not print formatted files. Instead, print diffs to standard output.
+//	-l
+//		Do not print formatted files. Instead, print the names of files
+//		whose formatting differs from gdlfmt's.
+//	-w
+//		Do not print formatted files. Instead, overwrite files whose formatting
+//		differs from gdlfmt's with the formatted version.
+//
+// See [gdl.Format] for a description of the formatting.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/jba/gdl"
+	"rsc.io/diff"
+)
+
+var (
+	list   = flag.Bool("l", false, "list files whose formatting differs from gdlfmt's")
+	write  = flag.Bool("w", false, "write result to (source) file instead of stdout")
+	doDiff = flag.Bool("d", false, "display diffs instead of rewriting files")
+)
+
+var exitCode = 0
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: gdlfmt [flags] [path ...]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		if *write {
+			fmt.Fprintln(os.Stderr, "gdlfmt: cannot use -w with standard input")
+			os.Exit(2)
+		}
+		if err := processFile("<standard input>", os.Stdin); err != nil {
+			report(err)
+		}
+		os.Exit(exitCode)
+	}
+	for _, arg := range flag.Args() {
+		info, err := os.Stat(arg)
+		if err != nil {
+			report(err)
+			continue
+		}
+		if !info.IsDir() {
+			if err := processFile(arg, nil); err != nil {
+				report(err)
+			}
+			continue
+		}
+		err = filepath.WalkDir(arg, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && filepath.Ext(path) == ".gdl" {
+				if err := processFile(path, nil); err != nil {
+					report(err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			report(err)
+		}
+	}
+	os.Exit(exitCode)
+}
+
+// processFile formats the named file, reading it from in if in is non-nil.
+func processFile(filename string, in io.Reader) error {
+	if in == nil {
+		f, err := os.Open(filename)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	src, err := io.ReadAll(in)
+	if err != nil {
+		return err
+	}
+	// Parse with the file name, so that errors include it.
+	f, err := gdl.ParseSyntax(filename, src)
+	if err != nil {
+		return err
+	}
+	res := f.Format()
+	if !*list && !*write && !*doDiff {
+		_, err := os.Stdout.Write(res)
+		return err
+	}
+	if bytes.Equal(src, res) {
+		return nil
+	}
+	if *list {
+		fmt.Println(filename)
+	}
+	if *write {
+		info, err := os.Stat(filename)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filename, res, info.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+	if *doDiff {
+		fmt.Printf("diff %s.orig %s\n", filename, filename)
+		fmt.Print(diff.Format(string(src), string(res)))
+	}
+	return nil
+}
+
+func report(err error) {
+	fmt.Fprintf(os.Stderr, "gdlfmt: %v\n", err)
+	exitCode = 2
+}
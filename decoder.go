@@ -0,0 +1,199 @@
+// Copyright 2024 by Jonathan Amsterdam.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package gdl
+
+import (
+	"fmt"
+	"io"
+	"iter"
+	"reflect"
+)
+
+// A Decoder reads Values from an input stream.
+//
+// Unlike [Parse], a Decoder does not read all of its input before returning
+// the first Value. It holds only the current line and the prefixes of the
+// enclosing blocks in memory, so it can read inputs of any size.
+type Decoder struct {
+	p         *parser
+	prefix    []Word // words of the enclosing block prefixes
+	prefixes  []int  // len(prefix) before each enclosing block was opened
+	val       Value
+	err       error
+	allErrors bool    // see AllErrors
+	errs      []error // errors so far, if allErrors is set
+
+	allowRepeats bool         // see AllowRepeatedKeywords
+	types        typeRegistry // see RegisterType
+	cfg          config       // see SetNaming and UseJSONTags
+}
+
+// NewDecoder returns a Decoder that reads from r.
+// If r has a Name method, as [*os.File] does, its result is used as
+// the file name of each Value.
+func NewDecoder(r io.Reader) *Decoder {
+	filename := "<no file>"
+	if n, ok := r.(interface{ Name() string }); ok {
+		filename = n.Name()
+	}
+	return &Decoder{p: newParser(newReaderLexer(r, filename))}
+}
+
+// AllErrors makes the Decoder continue after errors, instead of stopping
+// at the first one.
+// After a syntax error, the Decoder skips the rest of the line and resumes
+// with the next. [Decoder.Decode] keeps unmarshaling the remaining Values
+// after one fails.
+// [Decoder.Err] and Decode then return all the errors, sorted by position,
+// as an [ErrorList].
+func (d *Decoder) AllErrors() {
+	d.allErrors = true
+}
+
+// AllowRepeatedKeywords makes [Decoder.Decode] accept a keyword for
+// a scalar field more than once. The last occurrence determines the value.
+func (d *Decoder) AllowRepeatedKeywords() {
+	d.allowRepeats = true
+}
+
+// SetNaming sets how [Decoder.Decode] derives keywords from the names of
+// struct fields that don't have keywords in their tags.
+// The default is [CamelCase].
+func (d *Decoder) SetNaming(n Naming) {
+	d.cfg.naming = n
+}
+
+// UseJSONTags makes [Decoder.Decode] use the name in a field's json tag
+// as its keyword, if the field has no keyword in a gdl tag.
+func (d *Decoder) UseJSONTags() {
+	d.cfg.jsonTags = true
+}
+
+// AllowBoolWords makes [Decoder.Decode] accept "yes" and "on" as true,
+// and "no" and "off" as false, for bool fields, in addition to
+// "true" and "false".
+func (d *Decoder) AllowBoolWords() {
+	d.cfg.boolWords = true
+}
+
+// Next advances the Decoder to the next Value, which will then be available
+// from [Decoder.Value]. It returns false at the end of the input or
+// when there is an error. After Next returns false, [Decoder.Err]
+// returns the error, if any.
+func (d *Decoder) Next() bool {
+	if d.err != nil {
+		return false
+	}
+	for {
+		it, err := d.p.item()
+		if err != nil {
+			err = d.p.wrapErr(err)
+			if !d.allErrors {
+				d.err = err
+				return false
+			}
+			d.errs = append(d.errs, err)
+			// The parser may have closed a block without returning
+			// an itemClose for it, as for the junk in ") x".
+			for len(d.prefixes) > len(d.p.blocks) {
+				d.prefix = d.prefix[:d.prefixes[len(d.prefixes)-1]]
+				d.prefixes = d.prefixes[:len(d.prefixes)-1]
+			}
+			if !d.p.skipLine() {
+				d.err = io.EOF
+				return false
+			}
+			continue
+		}
+		switch it.kind {
+		case itemEOF:
+			d.err = io.EOF
+			return false
+		case itemLine:
+			d.val = lineValue(d.prefix, it.line, d.p.lex.filename)
+			return true
+		case itemOpen:
+			d.prefixes = append(d.prefixes, len(d.prefix))
+			d.prefix = append(d.prefix, it.block.Prefix...)
+		case itemClose:
+			d.prefix = d.prefix[:d.prefixes[len(d.prefixes)-1]]
+			d.prefixes = d.prefixes[:len(d.prefixes)-1]
+		}
+	}
+}
+
+// Value returns the Value read by the most recent call to [Decoder.Next].
+func (d *Decoder) Value() Value {
+	return d.val
+}
+
+// Err returns the first error encountered by the Decoder, or nil if
+// there was none or the end of the input was reached.
+// If [Decoder.AllErrors] was called, it returns all the errors so far
+// as an [ErrorList], or nil if there were none.
+func (d *Decoder) Err() error {
+	if d.allErrors {
+		if len(d.errs) == 0 {
+			return nil
+		}
+		return sortErrors(d.errs)
+	}
+	if d.err == io.EOF {
+		return nil
+	}
+	return d.err
+}
+
+// Decode reads the remaining Values from the input and unmarshals them
+// into p, which must be a pointer to a struct, map, slice, array or any,
+// as with [UnmarshalValues].
+//
+// If [Decoder.AllErrors] was called, Decode reads all the input even if there are
+// errors, leaving p populated from the Values that could be unmarshaled.
+func (d *Decoder) Decode(p any) error {
+	rv := reflect.ValueOf(p)
+	if rv.Kind() == reflect.Pointer && !rv.IsNil() && isAny(rv.Type().Elem()) {
+		root := &Node{}
+		for d.Next() {
+			root.add(d.Value())
+		}
+		setAny(rv.Elem(), root)
+		return d.Err()
+	}
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || !isTarget(rv.Type().Elem()) {
+		return fmt.Errorf("gdl.Decoder.Decode: argument must be pointer to struct, map, slice, array or any, not %T", p)
+	}
+	rv = rv.Elem()
+	st := newDecodeState()
+	st.allowRepeats = d.allowRepeats
+	st.types = &d.types
+	st.cfg = d.cfg
+	for d.Next() {
+		if err := st.unmarshalValue(d.Value(), rv, true); err != nil {
+			if !d.allErrors {
+				d.err = err
+				return err
+			}
+			d.errs = append(d.errs, err)
+		}
+	}
+	return d.Err()
+}
+
+// All returns an iterator over the remaining Values of the input.
+// If there is an error, the iterator yields it with a zero Value
+// and then stops.
+func (d *Decoder) All() iter.Seq2[Value, error] {
+	return func(yield func(Value, error) bool) {
+		for d.Next() {
+			if !yield(d.Value(), nil) {
+				return
+			}
+		}
+		if err := d.Err(); err != nil {
+			yield(Value{}, err)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright 2024 by Jonathan Amsterdam.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package gdl
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestDecoder(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"a",
+		"a b\nc d\n",
+		"a; b;c",
+		"// c\n\na b // s\n// end\n",
+		"h1 h2 (args a b; f(c; d))\n",
+		"require (\n\t// first\n\tm1 v1 // s\n\n\tm2 v2\n) // after\n",
+		"a `raw\nstring\n` \\\n  continued\nb\n",
+		"x (\n  a `\n`\n)\n",
+		"(\n)\n",
+	} {
+		want, err := Parse(in)
+		if err != nil {
+			t.Fatalf("%q: %v", in, err)
+		}
+		// Reading a byte at a time checks that lines are refilled properly.
+		var got []Value
+		for v, err := range NewDecoder(iotest.OneByteReader(strings.NewReader(in))).All() {
+			if err != nil {
+				t.Fatalf("%q: %v", in, err)
+			}
+			got = append(got, v)
+		}
+		// Positions must agree too, so compare everything.
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%q:\ngot  %+v\nwant %+v", in, got, want)
+		}
+	}
+}
+
+func TestDecoderError(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want string
+	}{
+		{"a\nb (\nc", "unexpected EOF"},
+		{"a\n)", "<no file>:2:1: unexpected close paren"},
+		{"a `raw\n", "unterminated raw string started on line 1"},
+		{"a\nb\n\"c", "<no file>:3:1: unterminated double-quoted string"},
+	} {
+		d := NewDecoder(strings.NewReader(tc.in))
+		for d.Next() {
+		}
+		matchError(t, tc.in, d.Err(), tc.want)
+		// The Decoder stays stopped.
+		if d.Next() {
+			t.Errorf("%q: Next after error returned true", tc.in)
+		}
+	}
+}
+
+func TestDecoderAllErrorsClose(t *testing.T) {
+	// Junk after a close paren is an error, but the block is still closed.
+	for _, tc := range []struct {
+		in   string
+		want [][]string
+	}{
+		{"a (\n b\n) x\nc d\n", [][]string{{"a", "b"}, {"c", "d"}}},
+		{"x (\n a (\n  b\n ) y\n c\n)\ne f\n", [][]string{{"x", "a", "b"}, {"x", "c"}, {"e", "f"}}},
+	} {
+		d := NewDecoder(strings.NewReader(tc.in))
+		d.AllErrors()
+		var got [][]string
+		for d.Next() {
+			got = append(got, d.Value().Words)
+		}
+		if d.Err() == nil {
+			t.Errorf("%q: got no error", tc.in)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%q: got %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestDecoderErrReader(t *testing.T) {
+	d := NewDecoder(iotest.TimeoutReader(strings.NewReader("a b\n")))
+	var n int
+	for _, err := range d.All() {
+		if err != nil {
+			matchError(t, "timeout", err, "timeout")
+			break
+		}
+		n++
+	}
+	if n != 1 {
+		t.Errorf("got %d values before the error, want 1", n)
+	}
+}
+
+func TestDecoderAllErrors(t *testing.T) {
+	const in = `require m1 v1
+) x
+)
+req x
+require m2 "v2
+require (
+	m3 v3
+	m4 "v4
+	m5 v5
+)
+require m6 v6
+`
+	type cfg struct {
+		Requires []Require
+	}
+
+	d := NewDecoder(strings.NewReader(in))
+	d.AllErrors()
+	var got cfg
+	err := d.Decode(&got)
+	var el ErrorList
+	if !errors.As(err, &el) {
+		t.Fatalf("got %v, want ErrorList", err)
+	}
+	var lines []int
+	for _, e := range el {
+		l, _ := errorPos(e)
+		lines = append(lines, l)
+	}
+	if want := []int{2, 3, 4, 5, 8}; !slices.Equal(lines, want) {
+		t.Errorf("got errors on lines %v, want %v\n%v", lines, want, err)
+	}
+	if !errors.Is(err, ErrUnknownKeyword) {
+		t.Error("errors.Is(err, ErrUnknownKeyword) is false")
+	}
+	want := cfg{Requires: []Require{{"m1", "v1"}, {"m3", "v3"}, {"m5", "v5"}, {"m6", "v6"}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	// A Value with an error adds nothing to the partial result.
+	type thing struct {
+		Count int
+		Sizes []int
+	}
+	type things struct {
+		Things []thing
+	}
+	d = NewDecoder(strings.NewReader("thing x\nthing 1 2 y\nthing 3 4\n"))
+	d.AllErrors()
+	var gotThings things
+	if err := d.Decode(&gotThings); err == nil {
+		t.Error("got nil, want error")
+	}
+	wantThings := things{Things: []thing{{3, []int{4}}}}
+	if !reflect.DeepEqual(gotThings, wantThings) {
+		t.Errorf("got %+v, want %+v", gotThings, wantThings)
+	}
+}
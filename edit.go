@@ -0,0 +1,288 @@
+// Copyright 2024 by Jonathan Amsterdam.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package gdl
+
+import (
+	"slices"
+	"strings"
+)
+
+// This file holds operations for editing a File.
+// The edits change as little of the file as possible; see [File.Bytes].
+
+// AddLine adds a line with the given words, prefixed by prefix, and returns it.
+//
+// If there is a block whose prefix, together with the prefixes of its enclosing
+// blocks, equals prefix, the line is added to the end of that block.
+// Otherwise, if there is a line that begins with prefix, that line is replaced by a
+// block with the prefix, holding the rest of the existing line and then the new one.
+// Otherwise, a new line consisting of prefix followed by words is added after the last
+// top-level statement beginning with prefix[0], or at the end of the file if there is none.
+//
+// The words are values, as returned by [Word.Value]. They are quoted if necessary.
+func (f *File) AddLine(prefix []string, words ...string) *Line {
+	line := &Line{Words: newWords(words)}
+	if len(prefix) > 0 {
+		if b := findBlock(f.Stmts, nil, prefix); b != nil {
+			b.Stmts = append(b.Stmts, line)
+			return line
+		}
+		if stmts, i, n := findLineWithPrefix(&f.Stmts, nil, prefix); stmts != nil {
+			old := (*stmts)[i].(*Line)
+			rest := &Line{
+				Comments: Comments{Suffix: old.Suffix},
+				Words:    old.Words[n:],
+			}
+			(*stmts)[i] = &Block{
+				Comments: Comments{Before: old.Before},
+				Prefix:   old.Words[:n],
+				Stmts:    []Stmt{rest, line},
+				open:     leadSrc(old.src),
+			}
+			return line
+		}
+	}
+	line.Words = append(newWords(prefix), line.Words...)
+	i := len(f.Stmts)
+	if len(prefix) > 0 {
+		for j, s := range f.Stmts {
+			if ws := stmtWords(s); len(ws) > 0 && ws[0].Value() == prefix[0] {
+				i = j + 1
+			}
+		}
+	}
+	f.Stmts = slices.Insert(f.Stmts, i, Stmt(line))
+	return line
+}
+
+// DropLines removes every line for which match returns true, and returns
+// the number of lines removed.
+// The argument to match is the words of the line as values, preceded by
+// the prefixes of its enclosing blocks.
+// Blocks that are left empty are not removed; call [File.Cleanup] to do that.
+func (f *File) DropLines(match func(words []string) bool) int {
+	n := 0
+	var drop func(stmts []Stmt, prefix []string) []Stmt
+	drop = func(stmts []Stmt, prefix []string) []Stmt {
+		kept := stmts[:0]
+		for i, s := range stmts {
+			switch s := s.(type) {
+			case *Line:
+				if match(append(prefix[:len(prefix):len(prefix)], wordValues(s.Words)...)) {
+					n++
+					dropSrc(s, kept, stmts[i+1:])
+					continue
+				}
+			case *Block:
+				s.Stmts = drop(s.Stmts, append(prefix[:len(prefix):len(prefix)], wordValues(s.Prefix)...))
+			}
+			kept = append(kept, s)
+		}
+		clear(stmts[len(kept):])
+		return kept
+	}
+	f.Stmts = drop(f.Stmts, nil)
+	return n
+}
+
+// dropSrc adjusts the source text of the statements around a line that is
+// being dropped, so that a ';' separating it from a statement on the same line
+// goes with it. The statements before the line that are kept are in kept, and
+// those after it are in rest.
+func dropSrc(l *Line, kept, rest []Stmt) {
+	if l.src == nil || l.src.body == "" {
+		return
+	}
+	if !strings.Contains(l.src.tail, "\n") && len(rest) > 0 {
+		// The next statement takes the line's place.
+		if next := openSrc(rest[0]); next != nil {
+			next.lead = l.src.lead
+			next.before = l.src.before
+		}
+		return
+	}
+	if len(kept) > 0 {
+		// The previous statement, if it is on the same line, takes the line's ending.
+		prev := closeSrc(kept[len(kept)-1])
+		if prev != nil && prev.body != "" && !strings.Contains(prev.tail, "\n") &&
+			strings.HasSuffix(prev.body, prev.tail) {
+			prev.body = strings.TrimSuffix(prev.body, prev.tail) + l.src.tail
+			prev.tail = l.src.tail
+		}
+	}
+}
+
+// openSrc returns the source of the start of a statement.
+func openSrc(s Stmt) *nodeSrc {
+	switch s := s.(type) {
+	case *Line:
+		return s.src
+	case *Block:
+		return s.open
+	}
+	return nil
+}
+
+// closeSrc returns the source of the end of a statement.
+func closeSrc(s Stmt) *nodeSrc {
+	switch s := s.(type) {
+	case *Line:
+		return s.src
+	case *Block:
+		return s.close
+	}
+	return nil
+}
+
+// FindLine returns the first line for which match returns true, or nil if there
+// is none.
+// The argument to match is as for [File.DropLines].
+func (f *File) FindLine(match func(words []string) bool) *Line {
+	var find func(stmts []Stmt, prefix []string) *Line
+	find = func(stmts []Stmt, prefix []string) *Line {
+		for _, s := range stmts {
+			switch s := s.(type) {
+			case *Line:
+				if match(append(prefix[:len(prefix):len(prefix)], wordValues(s.Words)...)) {
+					return s
+				}
+			case *Block:
+				if l := find(s.Stmts, append(prefix[:len(prefix):len(prefix)], wordValues(s.Prefix)...)); l != nil {
+					return l
+				}
+			}
+		}
+		return nil
+	}
+	return find(f.Stmts, nil)
+}
+
+// Cleanup tidies the file after edits.
+// It removes blocks that have become empty, and replaces blocks that have
+// been reduced to a single line by that line.
+// Blocks that have not been changed by edits are left alone.
+func (f *File) Cleanup() {
+	f.Stmts = cleanup(f.Stmts)
+}
+
+func cleanup(stmts []Stmt) []Stmt {
+	var r []Stmt
+	for _, s := range stmts {
+		b, ok := s.(*Block)
+		if !ok {
+			r = append(r, s)
+			continue
+		}
+		b.Stmts = cleanup(b.Stmts)
+		changed := b.open == nil || len(b.Stmts) != b.nstmt
+		switch {
+		case changed && len(b.Stmts) == 0:
+			// Drop the block.
+		case changed && len(b.Stmts) == 1:
+			if l, ok := b.Stmts[0].(*Line); ok {
+				r = append(r, &Line{
+					Comments: Comments{
+						Before: append(b.Before, l.Before...),
+						Suffix: l.Suffix,
+					},
+					Words: append(slices.Clone(b.Prefix), l.Words...),
+					src:   leadSrc(b.open),
+				})
+			} else {
+				r = append(r, b)
+			}
+		default:
+			r = append(r, b)
+		}
+	}
+	return r
+}
+
+// SetWords sets the words of the line, not including the prefixes of any
+// enclosing blocks.
+// The words are values, as returned by [Word.Value]. They are quoted if necessary.
+// A word whose value is unchanged keeps its original quoting.
+func (l *Line) SetWords(words ...string) {
+	ws := newWords(words)
+	for i := range ws {
+		if i < len(l.Words) && l.Words[i].Value() == words[i] {
+			ws[i] = l.Words[i]
+		}
+	}
+	l.Words = ws
+}
+
+func newWords(vals []string) []Word {
+	var ws []Word
+	for _, v := range vals {
+		ws = append(ws, Word{Token: quoteWord(v)})
+	}
+	return ws
+}
+
+// leadSrc returns a nodeSrc that preserves only the text preceding a node,
+// for a new node that replaces it.
+func leadSrc(src *nodeSrc) *nodeSrc {
+	if src == nil {
+		return nil
+	}
+	return &nodeSrc{lead: src.lead, before: src.before}
+}
+
+// findBlock returns the first block in stmts whose prefix, appended to
+// outer, equals prefix.
+func findBlock(stmts []Stmt, outer, prefix []string) *Block {
+	for _, s := range stmts {
+		b, ok := s.(*Block)
+		if !ok {
+			continue
+		}
+		p := append(outer[:len(outer):len(outer)], wordValues(b.Prefix)...)
+		if slices.Equal(p, prefix) {
+			return b
+		}
+		if len(p) <= len(prefix) && slices.Equal(p, prefix[:len(p)]) {
+			if b := findBlock(b.Stmts, p, prefix); b != nil {
+				return b
+			}
+		}
+	}
+	return nil
+}
+
+// findLineWithPrefix finds the first line in *stmts that, appended to outer,
+// begins with prefix and has more words.
+// It returns the slice containing the line, the line's index in it, and the
+// number of the line's own words that are part of prefix.
+func findLineWithPrefix(stmts *[]Stmt, outer, prefix []string) (*[]Stmt, int, int) {
+	for i, s := range *stmts {
+		switch s := s.(type) {
+		case *Line:
+			ws := append(outer[:len(outer):len(outer)], wordValues(s.Words)...)
+			if len(ws) > len(prefix) && len(outer) < len(prefix) && slices.Equal(ws[:len(prefix)], prefix) {
+				return stmts, i, len(prefix) - len(outer)
+			}
+		case *Block:
+			p := append(outer[:len(outer):len(outer)], wordValues(s.Prefix)...)
+			if len(p) < len(prefix) && slices.Equal(p, prefix[:len(p)]) {
+				if ss, i, n := findLineWithPrefix(&s.Stmts, p, prefix); ss != nil {
+					return ss, i, n
+				}
+			}
+		}
+	}
+	return nil, 0, 0
+}
+
+// stmtWords returns the words of a line or the prefix of a block.
+func stmtWords(s Stmt) []Word {
+	switch s := s.(type) {
+	case *Line:
+		return s.Words
+	case *Block:
+		return s.Prefix
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+// Copyright 2024 by Jonathan Amsterdam.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package gdl
+
+import (
+	"slices"
+	"testing"
+
+	"rsc.io/diff"
+)
+
+func TestBytesUnchanged(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"a",
+		"a b\n",
+		"  a   b  \n\n\n",
+		"// c\n\na b // s\n// end\n",
+		"a; b;c",
+		"x(a b)",
+		"x ( a b )  // s\n",
+		"h1 h2 (args a b; f(c; d))\n",
+		"require (\n\t// first\n\tm1 v1 // s\n\n\tm2 v2\n\t// last\n) // after\n\n// trailer",
+		"a `raw\nstring` \\\n  continued\n",
+		"(\n)\n",
+	} {
+		f, err := ParseSyntax("test", []byte(in))
+		if err != nil {
+			t.Fatalf("%q: %v", in, err)
+		}
+		if got := string(f.Bytes()); got != in {
+			t.Errorf("%q: got %q", in, got)
+		}
+	}
+}
+
+func TestEdit(t *testing.T) {
+	const in = `// A file.
+module m
+
+// Requirements.
+require (
+	a v1 // old
+	b v2
+)
+
+go 1.23 // version
+`
+	for _, tc := range []struct {
+		name string
+		edit func(*File)
+		want string
+	}{
+		{
+			"add to block",
+			func(f *File) { f.AddLine([]string{"require"}, "c", "v3") },
+			`// A file.
+module m
+
+// Requirements.
+require (
+	a v1 // old
+	b v2
+	c v3
+)
+
+go 1.23 // version
+`,
+		},
+		{
+			"add new",
+			func(f *File) { f.AddLine([]string{"replace"}, "a", "=>", "../a") },
+			`// A file.
+module m
+
+// Requirements.
+require (
+	a v1 // old
+	b v2
+)
+
+go 1.23 // version
+replace a => ../a
+`,
+		},
+		{
+			"add after same keyword",
+			func(f *File) { f.AddLine([]string{"module"}, "x y") },
+			`// A file.
+module (
+	m
+	"x y"
+)
+
+// Requirements.
+require (
+	a v1 // old
+	b v2
+)
+
+go 1.23 // version
+`,
+		},
+		{
+			"set words",
+			func(f *File) {
+				l := f.FindLine(func(ws []string) bool { return ws[0] == "require" && ws[1] == "a" })
+				l.SetWords("a", "v1.1")
+			},
+			`// A file.
+module m
+
+// Requirements.
+require (
+	a v1.1 // old
+	b v2
+)
+
+go 1.23 // version
+`,
+		},
+		{
+			"drop one",
+			func(f *File) {
+				f.DropLines(func(ws []string) bool { return ws[0] == "require" && ws[1] == "a" })
+				f.Cleanup()
+			},
+			`// A file.
+module m
+
+// Requirements.
+require b v2
+
+go 1.23 // version
+`,
+		},
+		{
+			"drop all",
+			func(f *File) {
+				f.DropLines(func(ws []string) bool { return ws[0] == "require" })
+				f.Cleanup()
+			},
+			`// A file.
+module m
+
+go 1.23 // version
+`,
+		},
+		{
+			"drop top",
+			func(f *File) {
+				f.DropLines(func(ws []string) bool { return ws[0] == "module" })
+				f.Cleanup()
+			},
+			`
+// Requirements.
+require (
+	a v1 // old
+	b v2
+)
+
+go 1.23 // version
+`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := ParseSyntax("test", []byte(in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tc.edit(f)
+			got := string(f.Bytes())
+			if got != tc.want {
+				t.Errorf("mismatch (-want, +got):\n%s", diff.Format(tc.want, got))
+			}
+			if _, err := ParseSyntax("test", []byte(got)); err != nil {
+				t.Errorf("output does not parse: %v", err)
+			}
+		})
+	}
+}
+
+func TestAddLineNested(t *testing.T) {
+	f, err := ParseSyntax("test", []byte("x(a b)\nh (f (c))\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.AddLine([]string{"x"}, "d")
+	f.AddLine([]string{"h", "f"}, "e")
+	got := string(f.Bytes())
+	want := "x(a b\n\td\n)\nh (f (c\n\t\te\n))\n"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	vals, err := Parse(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var words [][]string
+	for _, v := range vals {
+		words = append(words, v.Words)
+	}
+	wantWords := [][]string{{"x", "a", "b"}, {"x", "d"}, {"h", "f", "c"}, {"h", "f", "e"}}
+	if !slices.EqualFunc(words, wantWords, slices.Equal) {
+		t.Errorf("got %v, want %v", words, wantWords)
+	}
+}
+
+func TestEditLayout(t *testing.T) {
+	dropB := func(f *File) { f.DropLines(func(ws []string) bool { return ws[len(ws)-2] == "b" }) }
+	dropA := func(f *File) { f.DropLines(func(ws []string) bool { return ws[len(ws)-2] == "a" }) }
+	for _, tc := range []struct {
+		in   string
+		edit func(*File)
+		want string
+	}{
+		{"a 1; b 2 // c\n", dropA, "b 2 // c\n"},
+		{"a 1; b 2 // c\nd 3\n", dropB, "a 1\nd 3\n"},
+		{"a 1; b 2; a 3\n", dropA, "b 2\n"},
+		{"x (a 1; b 2)\n", dropA, "x (b 2)\n"},
+		{"x (a 1; b 2)\n", dropB, "x (a 1)\n"},
+		{"x (\n  a 1; b 2\n  c 3\n)\n", dropA, "x (\n  b 2\n  c 3\n)\n"},
+		{
+			"x y (\n  a\n)\n",
+			func(f *File) { f.AddLine([]string{"x", "y"}, "b") },
+			"x y (\n  a\n  b\n)\n",
+		},
+		{
+			"x (\n    a 1\n    y (\n      b 2\n    )\n)\n",
+			func(f *File) {
+				f.AddLine([]string{"x"}, "c", "3")
+				f.AddLine([]string{"x", "y"}, "d", "4")
+			},
+			"x (\n    a 1\n    y (\n      b 2\n      d 4\n    )\n    c 3\n)\n",
+		},
+	} {
+		f, err := ParseSyntax("test", []byte(tc.in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tc.edit(f)
+		if got := string(f.Bytes()); got != tc.want {
+			t.Errorf("%q: got %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
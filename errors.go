@@ -0,0 +1,115 @@
+// Copyright 2024 by Jonathan Amsterdam.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package gdl
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// A SyntaxError describes malformed gdl input.
+type SyntaxError struct {
+	File   string
+	Line   int
+	Column int // byte column, starting at 1; 0 if unknown
+	Err    error
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s: %v", formatPos(e.File, e.Line, e.Column), e.Err)
+}
+
+func (e *SyntaxError) Unwrap() error { return e.Err }
+
+// An UnmarshalError describes a Value that could not be unmarshaled.
+//
+// The position is that of Word, if there is one, or of the Value otherwise.
+// Err is the underlying problem: for example, [ErrUnknownKeyword], or a
+// [*strconv.NumError] for a malformed number.
+type UnmarshalError struct {
+	File   string
+	Line   int
+	Column int          // byte column, starting at 1; 0 if unknown
+	Word   string       // the word that could not be unmarshaled, or "" if none
+	Type   reflect.Type // the Go type that Word was being unmarshaled into
+	Field  string       // path of the field from the top-level struct, like "Requires.Version"; "" if none
+	Err    error
+
+	rest int // number of words from Word to the end of the Value, or 0 if no Word
+}
+
+func (e *UnmarshalError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: cannot unmarshal ", formatPos(e.File, e.Line, e.Column))
+	if e.rest > 0 {
+		fmt.Fprintf(&b, "%q ", e.Word)
+	}
+	if e.Field != "" {
+		fmt.Fprintf(&b, "into field %s of type %s", e.Field, e.Type)
+	} else {
+		fmt.Fprintf(&b, "into %s", e.Type)
+	}
+	fmt.Fprintf(&b, ": %v", e.Err)
+	return b.String()
+}
+
+func (e *UnmarshalError) Unwrap() error { return e.Err }
+
+// ErrUnknownKeyword is the underlying error of an [UnmarshalError] for
+// a word that does not select a field of the struct, either by position
+// or by keyword.
+var ErrUnknownKeyword = errors.New("unknown keyword")
+
+// An ErrorList is a list of errors, sorted by position.
+// A [Decoder] returns one after [Decoder.AllErrors] is called.
+// Like the result of [errors.Join], it works with [errors.Is] and [errors.As].
+type ErrorList []error
+
+func (l ErrorList) Error() string {
+	var b strings.Builder
+	for i, err := range l {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		b.WriteString(err.Error())
+	}
+	return b.String()
+}
+
+func (l ErrorList) Unwrap() []error { return l }
+
+// sortErrors returns errs as an ErrorList sorted by position.
+// Errors without a position come last.
+func sortErrors(errs []error) ErrorList {
+	l := ErrorList(slices.Clone(errs))
+	slices.SortStableFunc(l, func(e1, e2 error) int {
+		l1, c1 := errorPos(e1)
+		l2, c2 := errorPos(e2)
+		if c := cmp.Compare(l1, l2); c != 0 {
+			return c
+		}
+		return cmp.Compare(c1, c2)
+	})
+	return l
+}
+
+// errorPos returns the line and column of err, or a position
+// after all others if it has none.
+func errorPos(err error) (line, col int) {
+	var se *SyntaxError
+	if errors.As(err, &se) {
+		return se.Line, se.Column
+	}
+	var ue *UnmarshalError
+	if errors.As(err, &ue) {
+		return ue.Line, ue.Column
+	}
+	return math.MaxInt, 0
+}
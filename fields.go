@@ -0,0 +1,212 @@
+// Copyright 2024 by Jonathan Amsterdam.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package gdl
+
+import (
+	"cmp"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// structFields returns the fields of the struct type t that can be unmarshaled,
+// in the order of their indexes.
+//
+// The fields of embedded structs, and of embedded pointers to structs,
+// are promoted into t following the rules of encoding/json:
+// unexported fields are ignored, as are fields tagged "-";
+// an embedded struct with a name in its tag is not promoted, but treated
+// as an ordinary field.
+// Among fields with the same name, the one at the shallowest depth
+// of embedding wins; at the same depth, a field whose name comes from a tag wins.
+// If there is still more than one, all of them are ignored.
+//
+// The Index of each returned field is the full path from t. Fields reached
+// through a pointer to an unexported embedded struct are ignored, since
+// the pointer could not be allocated.
+func structFields(t reflect.Type) []reflect.StructField {
+	type embedded struct {
+		t     reflect.Type
+		index []int
+	}
+	type candidate struct {
+		sf     reflect.StructField
+		name   string
+		depth  int
+		tagged bool
+	}
+
+	var cands []candidate
+	visited := map[reflect.Type]bool{}
+	next := []embedded{{t: t}}
+	for depth := 0; len(next) > 0; depth++ {
+		current := next
+		next = nil
+		count := map[reflect.Type]int{}
+		for _, e := range current {
+			count[e.t]++
+		}
+		for _, e := range current {
+			// A type embedded at more than one depth is promoted only from the shallowest.
+			if visited[e.t] {
+				continue
+			}
+			visited[e.t] = true
+			for i := 0; i < e.t.NumField(); i++ {
+				sf := e.t.Field(i)
+				tag := sf.Tag.Get("gdl")
+				if tag == "-" {
+					continue
+				}
+				var name string
+				if kws := tagKeywords(tag); len(kws) > 0 {
+					name = kws[0]
+				}
+				index := append(slices.Clip(e.index), i)
+				if sf.Anonymous {
+					ft := sf.Type
+					isPtr := ft.Kind() == reflect.Pointer
+					if isPtr {
+						ft = ft.Elem()
+					}
+					if !sf.IsExported() && ft.Kind() != reflect.Struct {
+						continue
+					}
+					if name == "" && ft.Kind() == reflect.Struct {
+						if isPtr && !sf.IsExported() {
+							continue
+						}
+						next = append(next, embedded{ft, index})
+						continue
+					}
+				} else if !sf.IsExported() {
+					continue
+				}
+				sf.Index = index
+				tagged := name != ""
+				if !tagged {
+					name = sf.Name
+				}
+				// Names are matched as keywords, so they conflict if their keywords do.
+				name = lowerFirst(name)
+				cands = append(cands, candidate{sf, name, depth, tagged})
+				if count[e.t] > 1 {
+					// The type is embedded more than once at this depth,
+					// so its fields conflict with each other.
+					cands = append(cands, candidate{sf, name, depth, tagged})
+				}
+			}
+		}
+	}
+
+	// Find the dominant field for each name.
+	slices.SortFunc(cands, func(a, b candidate) int {
+		if c := strings.Compare(a.name, b.name); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(a.depth, b.depth); c != 0 {
+			return c
+		}
+		if a.tagged != b.tagged {
+			if a.tagged {
+				return -1
+			}
+			return 1
+		}
+		return slices.Compare(a.sf.Index, b.sf.Index)
+	})
+	var sfs []reflect.StructField
+	for len(cands) > 0 {
+		n := 1
+		for n < len(cands) && cands[n].name == cands[0].name {
+			n++
+		}
+		if n == 1 || cands[0].depth < cands[1].depth || cands[0].tagged && !cands[1].tagged {
+			sfs = append(sfs, cands[0].sf)
+		}
+		cands = cands[n:]
+	}
+	slices.SortFunc(sfs, func(a, b reflect.StructField) int {
+		return slices.Compare(a.Index, b.Index)
+	})
+	return sfs
+}
+
+// A span is the range of positions of the words that a field takes,
+// counting from 0 at the first word after the keyword or ID.
+type span struct {
+	start, end int // end is -1 if the field takes the rest of the words
+}
+
+// A layout assigns positions to the fields of a struct that take words by position.
+// A field is placed at the position after the previous field, unless the
+// name in its tag gives its positions, counting from 1:
+//
+//	"N"    the word at N, or the words starting at N for an array
+//	"N-M"  the words from N to M inclusive
+//	"N-"   the words from N to the end
+//	"*"    the words after the previous field to the end
+type layout struct {
+	t    reflect.Type
+	next int    // the next position
+	prev string // the field at the last position
+	open bool   // the field prev takes the rest of the words
+}
+
+// isPositionTag reports whether the name in a gdl tag is meant to give positions.
+func isPositionTag(name string) bool {
+	return name == "*" || (name != "" && '0' <= name[0] && name[0] <= '9')
+}
+
+// place returns the span of sf, which takes n words, or any number if n is -1.
+// If the positions of sf conflict with those of an earlier field, place
+// returns a non-nil conflict and leaves sf without positions: it can still
+// be selected by keyword, so the conflict is an error only if its positions
+// are used. The returned error is for a bad tag.
+func (l *layout) place(sf reflect.StructField, n int) (sp span, conflict, err error) {
+	name, _, _ := strings.Cut(sf.Tag.Get("gdl"), ",")
+	sp = span{start: l.next, end: -1}
+	if n >= 0 {
+		sp.end = l.next + n
+	}
+	if isPositionTag(name) && name != "*" {
+		first, last, isRange := strings.Cut(name, "-")
+		start, err := strconv.Atoi(first)
+		end := start
+		if err == nil && isRange && last != "" {
+			end, err = strconv.Atoi(last)
+		}
+		if err != nil || start < 1 || end < start {
+			return span{}, nil, fmt.Errorf("field %s of %s: bad position %q", sf.Name, l.t, name)
+		}
+		sp.start = start - 1
+		switch {
+		case n == -1 && !isRange:
+			return span{}, nil, fmt.Errorf("field %s of %s: position %q of a slice must be a range", sf.Name, l.t, name)
+		case n == -1 && last == "":
+			sp.end = -1
+		case n == -1:
+			sp.end = end
+		case isRange && (last == "" || end-start+1 != n):
+			return span{}, nil, fmt.Errorf("field %s of %s: range %q must have %d positions", sf.Name, l.t, name, n)
+		default:
+			sp.end = sp.start + n
+		}
+	} else if name == "*" && n != -1 {
+		return span{}, nil, fmt.Errorf("field %s of %s: position \"*\" is only for slices", sf.Name, l.t)
+	}
+	if l.open {
+		return span{}, fmt.Errorf("field %s of %s follows field %s, which takes the rest of the words", sf.Name, l.t, l.prev), nil
+	}
+	if sp.start < l.next {
+		return span{}, fmt.Errorf("field %s of %s: position %d is already taken by field %s", sf.Name, l.t, sp.start+1, l.prev), nil
+	}
+	l.next = sp.end
+	l.open = sp.end == -1
+	l.prev = sf.Name
+	return sp, nil, nil
+}
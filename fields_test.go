@@ -0,0 +1,81 @@
+// Copyright 2024 by Jonathan Amsterdam.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package gdl
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+type Metadata struct {
+	Name  string
+	Owner string
+}
+
+type Retry struct {
+	Attempts int
+	Owner    string
+}
+
+type Timeouts struct {
+	Connect int
+}
+
+type hidden struct {
+	Secret string
+}
+
+func TestStructFields(t *testing.T) {
+	type tagged struct {
+		Owner string `gdl:"owner"`
+	}
+	for _, tc := range []struct {
+		v    any
+		want []string
+	}{
+		{struct{ A, b, C int }{}, []string{"A", "C"}},
+		{struct {
+			A int
+			B int `gdl:"-"`
+		}{}, []string{"A"}},
+		// Promotion; Owner conflicts at the same depth, so it is dropped.
+		{struct {
+			Metadata
+			*Retry
+			Z int
+		}{}, []string{"Name", "Attempts", "Z"}},
+		// The shallower field wins.
+		{struct {
+			Metadata
+			Name string
+		}{}, []string{"Owner", "Name"}},
+		// A tagged field wins at the same depth.
+		{struct {
+			Metadata
+			tagged
+		}{}, []string{"Name", "Owner"}},
+		// A tagged embedded struct is not promoted.
+		{struct {
+			Timeouts `gdl:"timeouts"`
+		}{}, []string{"Timeouts"}},
+		// Unexported embedded structs are promoted, but not through pointers.
+		{struct {
+			hidden
+			T *struct{ *hidden }
+		}{}, []string{"Secret", "T"}},
+		{struct {
+			*hidden
+		}{}, nil},
+	} {
+		var got []string
+		for _, sf := range structFields(reflect.TypeOf(tc.v)) {
+			got = append(got, sf.Name)
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("%T: got %v, want %v", tc.v, got, tc.want)
+		}
+	}
+}
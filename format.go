@@ -0,0 +1,202 @@
+// Copyright 2024 by Jonathan Amsterdam.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package gdl
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Format returns the canonical formatting of the gdl source in data.
+// See [File.Format] for details.
+func Format(data []byte) ([]byte, error) {
+	f, err := ParseSyntax("", data)
+	if err != nil {
+		return nil, err
+	}
+	return f.Format(), nil
+}
+
+// Format returns the text of the file in canonical form.
+// Unlike [File.Bytes], it ignores the original layout of the file.
+//
+// Each statement is written on its own line, with the statements of a block
+// indented by one tab per level of nesting.
+// A quoted word is written as it appears in the input, so that it stays
+// distinct from a bare word with the same value; other words are quoted
+// only when necessary.
+// Within a block, the words of consecutive lines are aligned in columns,
+// as are their comments.
+// Comments and single blank lines between statements are preserved;
+// other blank lines are removed.
+func (f *File) Format() []byte {
+	var pr printer
+	last := pr.formatStmts(f.Stmts, 0, 0)
+	if len(f.After) > 0 {
+		pr.formatComments(f.After, 0, last)
+	}
+	return pr.Bytes()
+}
+
+// formatStmts writes stmts in canonical form.
+// last is the line of the end of the preceding statement or comment,
+// or 0 if a blank line should never precede the first statement.
+// It returns the line of the end of the last statement written.
+func (pr *printer) formatStmts(stmts []Stmt, depth, last int) int {
+	for i := 0; i < len(stmts); i++ {
+		switch s := stmts[i].(type) {
+		case *Block:
+			last = pr.formatComments(s.Before, depth, last)
+			last = pr.formatBlock(s, depth, last)
+		case *Line:
+			// Collect a run of lines to align.
+			j := i + 1
+			if depth > 0 {
+				for j < len(stmts) {
+					l, ok := stmts[j].(*Line)
+					if !ok || blankBefore(l, endLine(stmts[j-1])) {
+						break
+					}
+					j++
+				}
+			}
+			last = pr.formatLines(stmts[i:j], depth, last)
+			i = j - 1
+		}
+	}
+	return last
+}
+
+// formatLines writes a run of lines, aligning their words and comments
+// if there is more than one.
+func (pr *printer) formatLines(lines []Stmt, depth, last int) int {
+	var widths []int // column widths
+	var texts []string
+	for _, s := range lines {
+		l := s.(*Line)
+		if len(l.Words) == 0 {
+			continue
+		}
+		for j, w := range l.Words[:len(l.Words)-1] {
+			n := utf8.RuneCountInString(formatWord(w))
+			if j >= len(widths) {
+				widths = append(widths, n)
+			} else {
+				widths[j] = max(widths[j], n)
+			}
+		}
+	}
+	commentCol := 0
+	for _, s := range lines {
+		l := s.(*Line)
+		var b strings.Builder
+		for j, w := range l.Words {
+			if j > 0 {
+				b.WriteByte(' ')
+			}
+			t := formatWord(w)
+			b.WriteString(t)
+			if j < len(l.Words)-1 && len(lines) > 1 {
+				b.WriteString(strings.Repeat(" ", widths[j]-utf8.RuneCountInString(t)))
+			}
+		}
+		texts = append(texts, b.String())
+		commentCol = max(commentCol, utf8.RuneCountInString(b.String()))
+	}
+	for i, s := range lines {
+		l := s.(*Line)
+		last = pr.formatComments(l.Before, depth, last)
+		if last > 0 && l.Start.Line > last+1 {
+			pr.WriteByte('\n')
+		}
+		pr.indent(depth)
+		pr.WriteString(texts[i])
+		if len(l.Suffix) > 0 {
+			if len(lines) > 1 {
+				pr.WriteString(strings.Repeat(" ", commentCol-utf8.RuneCountInString(texts[i])))
+			}
+			pr.suffix(l.Suffix)
+		}
+		pr.WriteByte('\n')
+		last = endLine(l)
+	}
+	return last
+}
+
+func (pr *printer) formatBlock(b *Block, depth, last int) int {
+	if last > 0 && b.Start.Line > last+1 {
+		pr.WriteByte('\n')
+	}
+	pr.indent(depth)
+	for _, w := range b.Prefix {
+		pr.WriteString(formatWord(w))
+		pr.WriteByte(' ')
+	}
+	pr.WriteByte('(')
+	pr.suffix(b.LParen.Suffix)
+	pr.WriteByte('\n')
+	// No blank line at the start of a block.
+	last = pr.formatStmts(b.Stmts, depth+1, 0)
+	if len(b.Stmts) == 0 {
+		last = 0
+	}
+	pr.formatComments(b.RParen.Before, depth+1, last)
+	pr.indent(depth)
+	pr.WriteByte(')')
+	pr.suffix(b.RParen.Suffix)
+	pr.WriteByte('\n')
+	return b.RParen.Pos.Line
+}
+
+// formatComments writes whole-line comments, preserving single blank lines
+// between them and the preceding text.
+// It returns the line of the last comment, or last if there are no comments.
+func (pr *printer) formatComments(cs []Comment, depth, last int) int {
+	for _, c := range cs {
+		if last > 0 && c.Start.Line > last+1 {
+			pr.WriteByte('\n')
+		}
+		pr.indent(depth)
+		pr.WriteString(c.Token)
+		pr.WriteByte('\n')
+		last = c.Start.Line
+	}
+	return last
+}
+
+// blankBefore reports whether there is a blank line between the line of last
+// and the beginning of s, including its comments.
+func blankBefore(s Stmt, last int) bool {
+	if last == 0 {
+		return false
+	}
+	start, _ := s.Span()
+	if cs := s.Comment().Before; len(cs) > 0 {
+		start = cs[0].Start
+	}
+	return start.Line > last+1
+}
+
+// endLine returns the line on which s ends.
+func endLine(s Stmt) int {
+	switch s := s.(type) {
+	case *Line:
+		return s.End.Line
+	case *Block:
+		return s.RParen.Pos.Line
+	}
+	return 0
+}
+
+// formatWord returns the canonical form of w.
+func formatWord(w Word) string {
+	if w.Quoted() {
+		if _, err := strconv.Unquote(w.Token); err == nil {
+			return w.Token
+		}
+	}
+	return quoteWord(w.Value())
+}
@@ -0,0 +1,78 @@
+// Copyright 2024 by Jonathan Amsterdam.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package gdl
+
+import (
+	"testing"
+
+	"rsc.io/diff"
+)
+
+func TestFormat(t *testing.T) {
+	for _, tc := range []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"a", "a\n"},
+		{"  a   b  ", "a b\n"},
+		{"a; b", "a\nb\n"},
+		{"\n\na\n\n\n\nb\n\n\n", "a\n\nb\n"},
+		{"a \\\n  b \\\n c", "a b c\n"},
+		{`"a" "b c" ` + "`d`", "\"a\" \"b c\" `d`\n"},
+		{"`x\ny`", "`x\ny`\n"},
+		{`a  "1" 1  "\x41"`, "a \"1\" 1 \"\\x41\"\n"},
+		{"x(a b)", "x (\n\ta b\n)\n"},
+		{"x()", "x (\n)\n"},
+		{
+			"require (\n  a v1 // c1\n     bbb v22 // c2\n\n  cc v3\n)",
+			"require (\n\ta   v1  // c1\n\tbbb v22 // c2\n\n\tcc v3\n)\n",
+		},
+		{
+			"h (x a; yy (b; c); zzz d)",
+			"h (\n\tx a\n\tyy (\n\t\tb\n\t\tc\n\t)\n\tzzz d\n)\n",
+		},
+		{
+			"// c1\n\n// c2\na // s\n\n// end\n\n",
+			"// c1\n\n// c2\na // s\n\n// end\n",
+		},
+		{
+			"x ( // open\n\n  // first\n  a\n  // last\n\n) // close",
+			"x ( // open\n\t// first\n\ta\n\t// last\n) // close\n",
+		},
+		{
+			"x (\n  a b c\n  dd e\n  f\n)",
+			"x (\n\ta  b c\n\tdd e\n\tf\n)\n",
+		},
+	} {
+		got, err := Format([]byte(tc.in))
+		if err != nil {
+			t.Fatalf("%q: %v", tc.in, err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("%q: mismatch (-want, +got):\n%s", tc.in, diff.Format(tc.want, string(got)))
+			continue
+		}
+		// Formatting must be idempotent.
+		got2, err := Format(got)
+		if err != nil {
+			t.Fatalf("%q: reformatting: %v", tc.in, err)
+		}
+		if string(got2) != string(got) {
+			t.Errorf("%q: not idempotent (-first, +second):\n%s", tc.in, diff.Format(string(got), string(got2)))
+		}
+		// Formatting must not change the values.
+		v1, err := Parse(tc.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v2, err := Parse(string(got))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g, w := vfmt.Sprint(v2), vfmt.Sprint(v1); g != w {
+			t.Errorf("%q: values changed:\ngot  %s\nwant %s", tc.in, g, w)
+		}
+	}
+}
@@ -4,10 +4,6 @@
 
 // TODO: rewrite pkg doc.
 
-// TODO: support unmarshaling into any.
-
-// TODO: support a struct tag like "2-" to mean from arg 2 to the end.
-
 // type Arg struct {
 // 	Name, Type string
 // }
@@ -58,7 +54,17 @@
 // A [Value] is a sequence of words along with its position in a file or string.
 // [Parse] takes a string and returns a sequence of Values; [ParseFile] does
 // the same for a file.
+// A [Decoder] reads Values one at a time from an [io.Reader], for large inputs,
+// and can unmarshal them while collecting every error instead of only the first.
+// [ParseSyntax] returns a [File], a syntax tree that retains the blocks and comments
+// of the input, for tools that read and rewrite gdl files.
+// Methods like [File.AddLine] and [File.DropLines] edit a File, and [File.Bytes]
+// writes it back out, leaving the parts that weren't edited as they were.
 // [Unmarshal] unpacks a [Value] or slice of Values into a Go struct or other type.
+// [Marshal] and [Encoder] go the other way, writing a Go struct as gdl text.
+// For input whose Go type isn't known, [Tree] arranges Values into a tree
+// of [Node]s, and unmarshaling into a *any produces maps, slices and scalars
+// as for JSON.
 package gdl
 
 import (
@@ -66,22 +72,73 @@ import (
 )
 
 // A Value is a sequence of words with their position.
+//
+// A Value that comes from a statement in a block begins with the words of the
+// block's prefix. Its Line, Start and End describe the statement itself, but
+// WordPos holds the position of every word, including those of the prefix.
+//
+// Tokens records how the words were written, so that "42" and 42
+// can be told apart even though both have the word "42".
 type Value struct {
-	Words []string
-	File  string
-	Line  int
+	Words   []string
+	File    string
+	Line    int        // line of the start of the statement
+	Start   Position   // start of the statement
+	End     Position   // end of the statement
+	WordPos []Position // position of each word, or nil if unknown
+	Tokens  []string   // each word as written, with any quotation marks, or nil if none was quoted
 }
 
 // Pos returns the position of the value as "file:line".
 func (l Value) Pos() string {
-	if l.File == "" && l.Line == 0 {
+	return formatPos(l.File, l.Line, 0)
+}
+
+// PosOf returns the position of the i'th word of the value as "file:line:col".
+// If the column of the word is unknown, it returns the same result as [Value.Pos].
+func (l Value) PosOf(i int) string {
+	line, col := l.lineCol(i)
+	return formatPos(l.File, line, col)
+}
+
+// IsQuoted reports whether the i'th word of the value was quoted.
+func (l Value) IsQuoted(i int) bool {
+	return i >= 0 && i < len(l.Tokens) && Word{Token: l.Tokens[i]}.Quoted()
+}
+
+// token returns the i'th word of the value as it was written,
+// or the word itself if that is unknown.
+func (l Value) token(i int) string {
+	if i < len(l.Tokens) {
+		return l.Tokens[i]
+	}
+	return l.Words[i]
+}
+
+// lineCol returns the line and column of the i'th word of the value.
+// If the column is unknown, it returns the line of the value and 0.
+func (l Value) lineCol(i int) (line, col int) {
+	if i < 0 || i >= len(l.WordPos) || !l.WordPos[i].IsValid() {
+		return l.Line, 0
+	}
+	return l.WordPos[i].Line, l.WordPos[i].Col
+}
+
+// formatPos formats a position as "file:line:col".
+// The column is omitted if it is zero, and the line too if it is zero.
+// An empty file is written as "?".
+func formatPos(file string, line, col int) string {
+	if file == "" && line == 0 {
 		return "?"
 	}
-	if l.Line == 0 {
-		return l.File
+	if line == 0 {
+		return file
+	}
+	if file == "" {
+		file = "?"
 	}
-	if l.File == "" {
-		return fmt.Sprintf("?:%d", l.Line)
+	if col == 0 {
+		return fmt.Sprintf("%s:%d", file, line)
 	}
-	return fmt.Sprintf("%s:%d", l.File, l.Line)
+	return fmt.Sprintf("%s:%d:%d", file, line, col)
 }
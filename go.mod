@@ -2,9 +2,9 @@ module github.com/jba/gdl
 
 go 1.23
 
-require github.com/google/go-cmp v0.6.0
-
 require (
-	github.com/jba/format v0.0.0-20241123125136-70a633f430e9 // indirect
-	rsc.io/diff v0.0.0-20190621135850-fe3479844c3c // indirect
+	github.com/google/go-cmp v0.6.0
+	rsc.io/diff v0.0.0-20190621135850-fe3479844c3c
 )
+
+require github.com/jba/format v0.0.0-20241123125136-70a633f430e9 // indirect
@@ -4,8 +4,6 @@
 
 // TODO: match the lexical properties of go.mod parsing.
 
-// TODO: record token position for gdlfmt.
-
 // TODO: fuzz the lexer.
 
 // TODO: any token starting with a digit should be interpreted as a number.
@@ -16,36 +14,84 @@
 package gdl
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
+	"io"
+	"strings"
 	"unicode"
 	"unicode/utf8"
 )
 
 type lexer struct {
-	s        string
-	filename string
-	lineno   int
-	ungotten bool
-	untok    token
-	errtok   token
+	s            string
+	end          int           // offset of the end of s in the input
+	r            *bufio.Reader // if non-nil, s is refilled from r a line at a time
+	readErr      error         // error from r, other than io.EOF
+	filename     string
+	lineno       int
+	lineStart    int  // offset of the start of the current line
+	keepComments bool // return comments as tokens
+	ungotten     bool
+	untok        token
+	errtok       token
 }
 
 func newLexer(s, filename string) *lexer {
-	return &lexer{s: s, filename: filename, lineno: 1}
+	return &lexer{s: s, end: len(s), filename: filename, lineno: 1}
+}
+
+// newReaderLexer returns a lexer that reads its input from r as needed.
+// Only the current line (or, for a raw string, the lines it spans)
+// is held in memory.
+func newReaderLexer(r io.Reader, filename string) *lexer {
+	return &lexer{r: bufio.NewReader(r), filename: filename, lineno: 1}
+}
+
+// readLine returns the next line of input, including its newline.
+// It returns the empty string if there is no more input or the lexer
+// does not read from a reader.
+func (l *lexer) readLine() string {
+	if l.r == nil {
+		return ""
+	}
+	line, err := l.r.ReadString('\n')
+	if err != nil {
+		if err != io.EOF {
+			l.readErr = err
+		}
+		l.r = nil
+	}
+	l.end += len(line)
+	return line
 }
 
 const (
-	tokWord   = 'w'
-	tokString = 's' // double-quoted or backquoted Go string
-	tokEOF    = 'E'
-	tokErr    = 'e'
+	tokWord    = 'w'
+	tokString  = 's' // double-quoted or backquoted Go string
+	tokComment = 'c' // only if keepComments is set
+	tokEOF     = 'E'
+	tokErr     = 'e'
 )
 
 type token struct {
-	kind rune
-	val  string
-	err  error
+	kind     rune
+	val      string
+	err      error
+	pos, end Position // start and end of the token in the input
+}
+
+// position returns the position of the start of s, which must
+// be a suffix of the lexer's input.
+func (l *lexer) position(s string) Position {
+	off := l.end - len(s)
+	return Position{Line: l.lineno, Col: off - l.lineStart + 1, Offset: off}
+}
+
+// newline records that the line ending just before s has been consumed.
+func (l *lexer) newline(s string) {
+	l.lineno++
+	l.lineStart = l.end - len(s)
 }
 
 func (l *lexer) error(err error) token {
@@ -56,6 +102,19 @@ func (l *lexer) error(err error) token {
 	return l.errtok
 }
 
+// skipLine discards the input up to and including the next newline,
+// and clears any error.
+func (l *lexer) skipLine() {
+	l.ungotten = false
+	l.errtok = token{}
+	if i := strings.IndexByte(l.s, '\n'); i >= 0 {
+		l.s = l.s[i+1:]
+		l.newline(l.s)
+	} else {
+		l.s = l.s[len(l.s):]
+	}
+}
+
 func (l *lexer) unget(tok token) {
 	if l.ungotten {
 		panic("unget twice")
@@ -72,7 +131,7 @@ func (l *lexer) peek() rune {
 	return l.untok.kind
 }
 
-func (l *lexer) next() token {
+func (l *lexer) next() (tok token) {
 	if l.ungotten {
 		l.ungotten = false
 		return l.untok
@@ -83,21 +142,43 @@ func (l *lexer) next() token {
 	}
 
 	s := l.s
-	defer func() { l.s = s }()
+	var pos Position
+	defer func() {
+		l.s = s
+		if tok.kind != tokErr {
+			tok.pos = pos
+			tok.end = l.position(s)
+		} else {
+			// Report the error at the start of the token where it occurred.
+			l.errtok.pos = pos
+			tok.pos = pos
+		}
+	}()
 
 loop:
 	for {
 		s = skipHorizontalSpace(s)
+		if len(s) == 0 {
+			// The input is always read a line at a time, so if there is more,
+			// we can continue from here.
+			if s = l.readLine(); len(s) > 0 {
+				continue
+			}
+			if l.readErr != nil {
+				return l.error(l.readErr)
+			}
+		}
+		pos = l.position(s)
 		if len(s) == 0 {
 			return token{kind: tokEOF}
 		}
 		c, sz := utf8.DecodeRuneInString(s)
-		if c == '\n' {
-			l.lineno++
-		}
 		switch c {
 		case '\n', '(', ')', '{', '}', ';':
 			s = s[sz:]
+			if c == '\n' {
+				l.newline(s)
+			}
 			// Semicolons look like newlines.
 			if c == ';' {
 				c = '\n'
@@ -107,16 +188,17 @@ loop:
 		case '/':
 			// Double slash is a comment to EOL.
 			if len(s) > 1 && s[1] == '/' {
-				s = s[2:]
-				for i, r := range s {
-					if r == '\n' {
-						// This newline is definitely a token.
-						s = s[i:]
-						continue loop
-					}
+				end := strings.IndexByte(s, '\n')
+				if end < 0 {
+					end = len(s)
 				}
-				s = s[sz:]
-				return token{kind: tokEOF}
+				text := s[:end]
+				// The newline, if any, is definitely a token.
+				s = s[end:]
+				if l.keepComments {
+					return token{kind: tokComment, val: strings.TrimRight(text, " \t\r")}
+				}
+				continue loop
 			}
 			// Single slash starts a word.
 			var word string
@@ -124,32 +206,52 @@ loop:
 			return token{kind: tokWord, val: word}
 
 		case '\\':
-			s = skipHorizontalSpace(s[1:])
-			if len(s) == 0 {
+			rest := skipHorizontalSpace(s[1:])
+			if len(rest) == 0 {
 				return l.error(errors.New("backlash at EOF"))
 			}
-			if s[0] == '\n' {
+			if rest[0] == '\n' {
 				// Continuation line. The newline is not a token.
 				// You can't use \ to continue a word because there must be
 				// a non-word rune before it, else it would be part of the word.
-				l.lineno++
-				s = s[1:]
+				s = rest[1:]
+				l.newline(s)
 				continue loop
 			}
+			// Otherwise, the backslash starts a word.
+			var word string
+			word, s = scanWord(s)
+			return token{kind: tokWord, val: word}
 
 		case '`':
 			start := l.lineno
-			for i, r := range s[1:] {
-				if r == '\n' { // TODO: \r as well?
-					l.lineno++
-				} else if r == '`' {
-					// Include quotes, for strconv.Unquote.
-					val := s[:i+2]
-					s = s[i+2:]
-					return token{kind: tokString, val: val}
+			i := 1
+			for {
+				j := strings.IndexAny(s[i:], "`\n") // TODO: \r as well?
+				if j < 0 {
+					// A raw string can span lines, so read more if we can.
+					if more := l.readLine(); more != "" {
+						s += more
+						continue
+					}
+					// There is no more input.
+					s = s[len(s):]
+					if l.readErr != nil {
+						return l.error(l.readErr)
+					}
+					return l.error(fmt.Errorf("unterminated raw string started on line %d", start))
+				}
+				i += j
+				if s[i] == '\n' {
+					i++
+					l.newline(s[i:])
+					continue
 				}
+				// Include quotes, for strconv.Unquote.
+				val := s[:i+1]
+				s = s[i+1:]
+				return token{kind: tokString, val: val}
 			}
-			return l.error(fmt.Errorf("unterminated raw string started on line %d", start))
 
 		case '"':
 			// Just scan to the end; strconv.Unquote will do the rest.
@@ -178,7 +280,6 @@ loop:
 			word, s = scanWord(s)
 			return token{kind: tokWord, val: word}
 		}
-		panic("unreachable")
 	}
 }
 
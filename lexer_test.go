@@ -50,6 +50,7 @@ func TestLexerNext(t *testing.T) {
 		{"a b\\c", []token{word("a"), word("b\\c")}},
 		{"a b\\\nc", []token{word("a"), word("b\\"), char('\n'), word("c")}},
 		{"a b \\\nc", []token{word("a"), word("b"), word("c")}},
+		{"a \\ b", []token{word("a"), word("\\"), word("b")}},
 	} {
 		l := newLexer(tc.in, "testcase")
 		var got []token
@@ -61,7 +62,7 @@ func TestLexerNext(t *testing.T) {
 			if tok.kind == tokEOF {
 				break
 			}
-			got = append(got, tok)
+			got = append(got, token{kind: tok.kind, val: tok.val})
 		}
 		if !slices.Equal(got, tc.want) {
 			t.Errorf("%q:\ngot  %v\nwant %v", tc.in, got, tc.want)
@@ -105,3 +106,25 @@ func TestScanWord(t *testing.T) {
 		}
 	}
 }
+
+func TestLexerComments(t *testing.T) {
+	l := newLexer("a // c1 \n// c2", "testcase")
+	l.keepComments = true
+	var got []token
+	for {
+		tok := l.next()
+		if tok.kind == tokEOF {
+			break
+		}
+		got = append(got, token{kind: tok.kind, val: tok.val})
+	}
+	want := []token{
+		{kind: tokWord, val: "a"},
+		{kind: tokComment, val: "// c1"},
+		{kind: '\n'},
+		{kind: tokComment, val: "// c2"},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got  %v\nwant %v", got, want)
+	}
+}
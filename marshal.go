@@ -0,0 +1,846 @@
+// Copyright 2024 by Jonathan Amsterdam.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package gdl
+
+import (
+	"bytes"
+	"encoding"
+	"fmt"
+	"io"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Marshal returns the gdl encoding of v, which must be a struct, a map with string keys,
+// or a pointer to either, or a []Value or *Node.
+// See [Encoder.Encode] for details.
+func Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// An Encoder writes gdl to an output stream.
+type Encoder struct {
+	w     io.Writer
+	types typeRegistry // see RegisterType
+	cfg   config       // see SetNaming and UseJSONTags
+}
+
+// NewEncoder returns a new Encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// SetNaming sets how [Encoder.Encode] derives keywords from the names of
+// struct fields that don't have keywords in their tags.
+// It should match the Naming of the Decoder that reads the output.
+// The default is [CamelCase].
+func (e *Encoder) SetNaming(n Naming) {
+	e.cfg.naming = n
+}
+
+// UseJSONTags makes [Encoder.Encode] use the name in a field's json tag
+// as its keyword, if the field has no keyword in a gdl tag.
+func (e *Encoder) UseJSONTags() {
+	e.cfg.jsonTags = true
+}
+
+// Encode writes the gdl encoding of v, which must be a struct, a map with string keys,
+// or a pointer to either, or a []Value or *Node, to the stream.
+//
+// The encoding is the inverse of [UnmarshalValues]: unmarshaling the output
+// into a value of the same type produces a value equal to v.
+// Each element of a slice of structs is written on its own line, beginning
+// with the singular form of the field's keyword. An element with an ID field is
+// written with its ID after the keyword.
+// Within those elements, scalar fields are written by position, followed by
+// the elements of a final slice of scalars. Positions that no field takes
+// are written as empty strings.
+// At the top level, scalar fields are written by position only if the struct
+// has no slices of structs; otherwise each non-zero scalar field, and each
+// non-empty slice of scalars, is written on its own line after its keyword,
+// the first keyword in the field's tag, or one derived from the field name
+// as set by [Encoder.SetNaming].
+// A struct field, or a non-nil pointer to a struct, is written as lines
+// beginning with its keyword, followed by its ID if it has one, and then
+// by its fields, each with its own keyword. A zero struct is omitted.
+// A field of interface type, or an element of a slice of interfaces, is
+// written like a struct, with the name registered for its dynamic type
+// by [RegisterType] after the keyword.
+// Each entry of a map is written on its own line, in key order, with the key
+// after the map field's keyword, or first for a top-level map, followed by
+// the value. A struct value is written as lines, like a struct field.
+// Consecutive lines beginning with the same word are grouped into a block.
+// The output is formatted as by [Format].
+//
+// Scalars of the types described at [UnmarshalValue] are written in the form
+// they are read in; the first layout of a [time.Time] field is used,
+// and a []byte has a prefix naming its encoding.
+// Fields of type any or []any, and map values of type any, cannot be
+// written unless they are nil or empty.
+// A value whose type implements [Marshaler] is written as the words returned by
+// its MarshalGDL method, and a scalar that implements [encoding.TextMarshaler]
+// is written as the result of its MarshalText method.
+//
+// Words are quoted only when necessary, except that the words of a []Value
+// or *Node that were quoted when parsed are written as they were parsed,
+// so that reading the output produces the same Values, or the same tree.
+func (e *Encoder) Encode(v any) error {
+	switch v := v.(type) {
+	case []Value:
+		var lines [][]Word
+		for _, val := range v {
+			lines = append(lines, valueWords(val))
+		}
+		_, err := e.w.Write(wordsFile(lines).Format())
+		return err
+	case *Node:
+		_, err := e.w.Write(wordsFile(v.lines(nil, nil)).Format())
+		return err
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Pointer && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct && rv.Kind() != reflect.Map {
+		return fmt.Errorf("gdl.Encode: argument must be struct, map or pointer to struct or map, not %T", v)
+	}
+	prog, err := programFor(rv.Type(), e.cfg)
+	if err != nil {
+		return err
+	}
+	es := &encodeState{types: &e.types, cfg: e.cfg}
+	var lines [][]string
+	if rv.Kind() == reflect.Map {
+		lines, err = es.encodeEntries(rv)
+	} else {
+		lines, err = prog.encodeTop(es, rv)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = e.w.Write(linesFile(lines).Format())
+	return err
+}
+
+// A Marshaler is a type that marshals itself into words.
+// It is the inverse of [Unmarshaler]: the words that MarshalGDL returns
+// should be accepted by UnmarshalGDL.
+type Marshaler interface {
+	MarshalGDL() ([]string, error)
+}
+
+var (
+	marshalerType     = reflect.TypeFor[Marshaler]()
+	textMarshalerType = reflect.TypeFor[encoding.TextMarshaler]()
+)
+
+// encodeState holds the state of a single call to Encode.
+type encodeState struct {
+	types *typeRegistry
+	cfg   config
+}
+
+// encodeTop encodes the top-level struct, using keywords if it has fields
+// that are only selected by keyword, or if its encoding by position
+// would be mistaken for a keyword.
+func (p *program) encodeTop(es *encodeState, rv reflect.Value) ([][]string, error) {
+	if p.keyed() {
+		return p.encodeKeyed(es, rv)
+	}
+	lines, err := p.encode(es, rv)
+	if err != nil {
+		return nil, err
+	}
+	// When a struct's words are read back, a first word that is a keyword
+	// will be treated as one.
+	if len(lines) > 0 && p.findKeyword(p.keyOps, lines[0][0]) != nil {
+		return p.encodeKeyed(es, rv)
+	}
+	return lines, nil
+}
+
+// keyed reports whether the top-level struct of p must be encoded
+// with keywords instead of as lines, its encoding by position: whether
+// it has fields that are only selected by keyword, or that have no positions.
+func (p *program) keyed() bool {
+	for _, f := range p.fields {
+		switch f.kind {
+		case structSliceField, structField, ifaceSliceField, ifaceField, stmtsField, mapField, anyField:
+			return true
+		}
+		if f.conflict != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeKeyed is like encode, but writes each scalar and slice-of-scalar field
+// on its own line, after its keyword.
+func (p *program) encodeKeyed(es *encodeState, rv reflect.Value) ([][]string, error) {
+	var lines [][]string
+	for _, f := range p.fields {
+		fv, ok := fieldValue(rv, f.sf)
+		if !ok {
+			continue
+		}
+		switch f.kind {
+		case scalarField:
+			if fv.IsZero() {
+				continue
+			}
+			w, err := f.opts.format(fv)
+			if err != nil {
+				return nil, err
+			}
+			lines = append(lines, []string{f.keyword, w})
+
+		case scalarSliceField:
+			if fv.Len() == 0 || fv.IsZero() {
+				continue
+			}
+			line := []string{f.keyword}
+			for i := 0; i < fv.Len(); i++ {
+				w, err := f.opts.format(fv.Index(i))
+				if err != nil {
+					return nil, err
+				}
+				line = append(line, w)
+			}
+			lines = append(lines, line)
+
+		case customField:
+			if fv.IsZero() {
+				continue
+			}
+			words, err := f.marshalGDL(fv)
+			if err != nil {
+				return nil, err
+			}
+			lines = append(lines, append([]string{f.keyword}, words...))
+
+		case structSliceField:
+			sublines, err := f.encodeStructSlice(es, fv)
+			if err != nil {
+				return nil, err
+			}
+			lines = append(lines, sublines...)
+
+		case structField:
+			sublines, err := f.encodeStruct(es, fv)
+			if err != nil {
+				return nil, err
+			}
+			lines = append(lines, sublines...)
+
+		case ifaceSliceField, stmtsField:
+			sublines, err := f.encodeVariants(es, fv)
+			if err != nil {
+				return nil, err
+			}
+			lines = append(lines, sublines...)
+
+		case ifaceField:
+			sublines, err := f.encodeVariant(es, fv)
+			if err != nil {
+				return nil, err
+			}
+			lines = append(lines, sublines...)
+
+		case mapField:
+			sublines, err := es.encodeEntries(fv)
+			if err != nil {
+				return nil, err
+			}
+			for _, sl := range sublines {
+				lines = append(lines, append([]string{f.keyword}, sl...))
+			}
+
+		case anyField:
+			if !fv.IsZero() {
+				return nil, fmt.Errorf("cannot marshal field %s of type %s", f.sf.Name, f.sf.Type)
+			}
+		}
+	}
+	return lines, nil
+}
+
+// encodeStructSlice returns a line for each element of fv, the value of
+// a struct-slice field f, beginning with the field's keyword.
+func (f *field) encodeStructSlice(es *encodeState, fv reflect.Value) ([][]string, error) {
+	var lines [][]string
+	for i := 0; i < fv.Len(); i++ {
+		elem := fv.Index(i)
+		if elem.Kind() == reflect.Pointer {
+			if elem.IsNil() {
+				elem = reflect.Zero(elem.Type().Elem())
+			} else {
+				elem = elem.Elem()
+			}
+		}
+		sublines, err := f.subprog.encodeElem(es, elem)
+		if err != nil {
+			return nil, err
+		}
+		for _, sl := range sublines {
+			lines = append(lines, append([]string{f.keyword}, sl...))
+		}
+	}
+	return lines, nil
+}
+
+// encode returns the lines that, when unmarshaled into a value of rv's type,
+// reproduce rv. rv is a struct.
+func (p *program) encode(es *encodeState, rv reflect.Value) ([][]string, error) {
+	var base []string
+	var lines [][]string
+	var nilField *field   // first nil pointer field, which must be followed by no words
+	var shortField *field // a slice with fewer words than its range, which must also be followed by no words
+	// place adds the words of f to base at f's positions.
+	place := func(f *field, words []string) error {
+		if len(words) == 0 {
+			return nil
+		}
+		if shortField != nil {
+			return fmt.Errorf("cannot marshal field %s, with fewer words than its positions, before field %s", shortField.sf.Name, f.sf.Name)
+		}
+		// Fill the positions that no field takes.
+		for len(base) < f.span.start {
+			base = append(base, "")
+		}
+		base = append(base, words...)
+		if f.span.end >= 0 && len(base) < f.span.end {
+			shortField = f
+		}
+		return nil
+	}
+	for _, f := range p.fields {
+		fv, ok := fieldValue(rv, f.sf)
+		if !ok {
+			// The field is in a nil embedded struct, so it is treated like a nil pointer.
+			if f.kind == scalarField && nilField == nil {
+				nilField = f
+			}
+			continue
+		}
+		if f.conflict != nil {
+			if fv.IsZero() {
+				continue
+			}
+			return nil, fmt.Errorf("cannot marshal field %s by position: %w", f.sf.Name, f.conflict)
+		}
+		switch f.kind {
+		case scalarField:
+			if fv.Kind() == reflect.Pointer && fv.IsNil() {
+				if nilField == nil {
+					nilField = f
+				}
+				continue
+			}
+			if nilField != nil {
+				return nil, fmt.Errorf("cannot marshal nil field %s before non-nil field %s", nilField.sf.Name, f.sf.Name)
+			}
+			w, err := f.opts.format(fv)
+			if err != nil {
+				return nil, err
+			}
+			if err := place(f, []string{w}); err != nil {
+				return nil, err
+			}
+
+		case scalarSliceField:
+			if nilField != nil && fv.Len() > 0 {
+				return nil, fmt.Errorf("cannot marshal nil field %s before non-empty field %s", nilField.sf.Name, f.sf.Name)
+			}
+			var words []string
+			for i := 0; i < fv.Len(); i++ {
+				w, err := f.opts.format(fv.Index(i))
+				if err != nil {
+					return nil, err
+				}
+				words = append(words, w)
+			}
+			if err := f.placeWords(words, place); err != nil {
+				return nil, err
+			}
+
+		case customField:
+			if nilField != nil && !fv.IsZero() {
+				return nil, fmt.Errorf("cannot marshal nil field %s before non-empty field %s", nilField.sf.Name, f.sf.Name)
+			}
+			words, err := f.marshalGDL(fv)
+			if err != nil {
+				return nil, err
+			}
+			if err := f.placeWords(words, place); err != nil {
+				return nil, err
+			}
+
+		case structSliceField:
+			sublines, err := f.encodeStructSlice(es, fv)
+			if err != nil {
+				return nil, err
+			}
+			lines = append(lines, sublines...)
+
+		case structField:
+			sublines, err := f.encodeStruct(es, fv)
+			if err != nil {
+				return nil, err
+			}
+			lines = append(lines, sublines...)
+
+		case ifaceSliceField, stmtsField:
+			sublines, err := f.encodeVariants(es, fv)
+			if err != nil {
+				return nil, err
+			}
+			lines = append(lines, sublines...)
+
+		case ifaceField:
+			sublines, err := f.encodeVariant(es, fv)
+			if err != nil {
+				return nil, err
+			}
+			lines = append(lines, sublines...)
+
+		case mapField:
+			sublines, err := es.encodeEntries(fv)
+			if err != nil {
+				return nil, err
+			}
+			for _, sl := range sublines {
+				lines = append(lines, append([]string{f.keyword}, sl...))
+			}
+
+		case anyField:
+			if !fv.IsZero() {
+				return nil, fmt.Errorf("cannot marshal field %s of type %s", f.sf.Name, f.sf.Type)
+			}
+		}
+	}
+	if p.conflict != nil && len(base) > 0 {
+		return nil, fmt.Errorf("cannot marshal %s by position: %w", p.t, p.conflict)
+	}
+	if len(lines) == 0 {
+		if len(base) == 0 {
+			return nil, nil
+		}
+		return [][]string{base}, nil
+	}
+	for i, l := range lines {
+		lines[i] = append(base[:len(base):len(base)], l...)
+	}
+	return lines, nil
+}
+
+// placeWords checks that words fit in the range of f, a field that takes
+// a variable number of words, and calls place to add them.
+func (f *field) placeWords(words []string, place func(*field, []string) error) error {
+	if f.span.end >= 0 && len(words) > f.span.end-f.span.start {
+		return fmt.Errorf("cannot marshal field %s: %d words for %d positions", f.sf.Name, len(words), f.span.end-f.span.start)
+	}
+	return place(f, words)
+}
+
+// marshalGDL returns the words of fv, the value of f, a custom field.
+// A slice has the words of each of its elements.
+func (f *field) marshalGDL(fv reflect.Value) ([]string, error) {
+	if !isMarshaler(fv.Type()) && fv.Kind() == reflect.Slice {
+		var words []string
+		for i := range fv.Len() {
+			ws, err := marshalGDL(fv.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			words = append(words, ws...)
+		}
+		return words, nil
+	}
+	return marshalGDL(fv)
+}
+
+// isMarshaler reports whether values of type t, or the values
+// they point to, can be marshaled by a [Marshaler].
+func isMarshaler(t reflect.Type) bool {
+	return t.Implements(marshalerType) || reflect.PointerTo(t).Implements(marshalerType)
+}
+
+// marshalGDL calls the MarshalGDL method of v. A nil pointer has no words.
+func marshalGDL(v reflect.Value) ([]string, error) {
+	if v.Kind() == reflect.Pointer && v.IsNil() {
+		return nil, nil
+	}
+	m, ok := asInterface(v, marshalerType).(Marshaler)
+	if !ok {
+		return nil, fmt.Errorf("cannot marshal value of type %s: it has no MarshalGDL method", v.Type())
+	}
+	return m.MarshalGDL()
+}
+
+// asInterface returns v, or a pointer to a copy of v, as a value of the
+// interface type it, or nil if neither implements it.
+func asInterface(v reflect.Value, it reflect.Type) any {
+	if v.Type().Implements(it) {
+		return v.Interface()
+	}
+	if reflect.PointerTo(v.Type()).Implements(it) {
+		p := reflect.New(v.Type())
+		p.Elem().Set(v)
+		return p.Interface()
+	}
+	return nil
+}
+
+// encodeElem encodes an element of a slice field.
+// Unlike encode, it always returns at least one line, so that an element
+// with no words is still represented.
+func (p *program) encodeElem(es *encodeState, rv reflect.Value) ([][]string, error) {
+	lines, err := p.encode(es, rv)
+	if err != nil {
+		return nil, err
+	}
+	return p.withID(rv, lines), nil
+}
+
+// withID returns lines with the ID of rv, if it has one, prepended to each.
+// It returns at least one line.
+func (p *program) withID(rv reflect.Value, lines [][]string) [][]string {
+	if len(lines) == 0 {
+		lines = [][]string{nil}
+	}
+	if p.idIndex != nil {
+		id := rv.FieldByIndex(p.idIndex).String()
+		for i, l := range lines {
+			lines[i] = append([]string{id}, l...)
+		}
+	}
+	return lines
+}
+
+// encodeStruct returns the lines for fv, the value of a struct field f,
+// each beginning with the field's keyword.
+// A zero struct or nil pointer has no lines.
+func (f *field) encodeStruct(es *encodeState, fv reflect.Value) ([][]string, error) {
+	if fv.Kind() == reflect.Pointer {
+		if fv.IsNil() {
+			return nil, nil
+		}
+		fv = fv.Elem()
+	} else if fv.IsZero() {
+		return nil, nil
+	}
+	lines, err := f.subprog.encodeKeyed(es, fv)
+	if err != nil {
+		return nil, err
+	}
+	lines = f.subprog.withID(fv, lines)
+	for i, l := range lines {
+		lines[i] = append([]string{f.keyword}, l...)
+	}
+	return lines, nil
+}
+
+// encodeVariants returns a line for each element of fv, the value of
+// an interface-slice field f, beginning with the field's keyword and
+// the name registered for the element's type.
+// The lines of a statements field begin with the name alone.
+func (f *field) encodeVariants(es *encodeState, fv reflect.Value) ([][]string, error) {
+	var lines [][]string
+	for i := 0; i < fv.Len(); i++ {
+		name, elem, err := es.variant(fv.Index(i))
+		if err != nil {
+			return nil, err
+		}
+		prog, err := programFor(elem.Type(), es.cfg)
+		if err != nil {
+			return nil, err
+		}
+		sublines, err := prog.encodeElem(es, elem)
+		if err != nil {
+			return nil, err
+		}
+		head := []string{f.keyword, name}
+		if f.kind == stmtsField {
+			head = head[1:]
+		}
+		for _, sl := range sublines {
+			lines = append(lines, append(slices.Clip(head), sl...))
+		}
+	}
+	return lines, nil
+}
+
+// encodeVariant returns the lines for fv, the value of an interface field f,
+// each beginning with the field's keyword and the name registered for
+// the value's type. A nil interface has no lines.
+func (f *field) encodeVariant(es *encodeState, fv reflect.Value) ([][]string, error) {
+	if fv.IsNil() {
+		return nil, nil
+	}
+	name, v, err := es.variant(fv)
+	if err != nil {
+		return nil, err
+	}
+	prog, err := programFor(v.Type(), es.cfg)
+	if err != nil {
+		return nil, err
+	}
+	lines, err := prog.encodeKeyed(es, v)
+	if err != nil {
+		return nil, err
+	}
+	lines = prog.withID(v, lines)
+	for i, l := range lines {
+		lines[i] = append([]string{f.keyword, name}, l...)
+	}
+	return lines, nil
+}
+
+// encodeEntries returns the lines for the entries of m, a map, in key order.
+// Each line begins with the key.
+func (es *encodeState) encodeEntries(m reflect.Value) ([][]string, error) {
+	keys := m.MapKeys()
+	slices.SortFunc(keys, func(a, b reflect.Value) int { return strings.Compare(a.String(), b.String()) })
+	et := m.Type().Elem()
+	if isAny(et) && len(keys) > 0 {
+		return nil, fmt.Errorf("cannot marshal map values of type %s", et)
+	}
+	var lines [][]string
+	for _, k := range keys {
+		key := k.String()
+		v := m.MapIndex(k)
+		switch {
+		case setScalarFunc(et, config{}) != nil:
+			w, err := formatScalar(v)
+			if err != nil {
+				return nil, err
+			}
+			lines = append(lines, []string{key, w})
+
+		case et.Kind() == reflect.Slice:
+			line := []string{key}
+			for i := 0; i < v.Len(); i++ {
+				w, err := formatScalar(v.Index(i))
+				if err != nil {
+					return nil, err
+				}
+				line = append(line, w)
+			}
+			lines = append(lines, line)
+
+		default:
+			if v.Kind() == reflect.Pointer {
+				if v.IsNil() {
+					lines = append(lines, []string{key})
+					continue
+				}
+				v = v.Elem()
+			}
+			prog, err := programFor(v.Type(), es.cfg)
+			if err != nil {
+				return nil, err
+			}
+			sublines, err := prog.encodeKeyed(es, v)
+			if err != nil {
+				return nil, err
+			}
+			if len(sublines) == 0 {
+				sublines = [][]string{nil}
+			}
+			for _, sl := range sublines {
+				lines = append(lines, append([]string{key}, sl...))
+			}
+		}
+	}
+	return lines, nil
+}
+
+// variant returns the name registered for the dynamic type of the interface
+// value iv, and the struct it holds.
+func (es *encodeState) variant(iv reflect.Value) (string, reflect.Value, error) {
+	if iv.IsNil() {
+		return "", reflect.Value{}, fmt.Errorf("cannot marshal nil %s", iv.Type())
+	}
+	v := iv.Elem()
+	name, ok := es.types.name(iv.Type(), v.Type())
+	if !ok {
+		return "", reflect.Value{}, fmt.Errorf("type %s is not registered for %s", v.Type(), iv.Type())
+	}
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return "", reflect.Value{}, fmt.Errorf("cannot marshal nil %s", v.Type())
+		}
+		v = v.Elem()
+	}
+	return name, v, nil
+}
+
+// fieldValue returns the value of the field sf of rv.
+// It returns false if the field is in an embedded struct that rv
+// points to with a nil pointer.
+func fieldValue(rv reflect.Value, sf reflect.StructField) (reflect.Value, bool) {
+	fv, err := rv.FieldByIndexErr(sf.Index)
+	return fv, err == nil
+}
+
+func formatScalar(v reflect.Value) (string, error) {
+	if v.Kind() != reflect.Pointer || !v.IsNil() {
+		if m, ok := asInterface(v, textMarshalerType).(encoding.TextMarshaler); ok {
+			b, err := m.MarshalText()
+			return string(b), err
+		}
+	}
+	switch {
+	case v.Type() == durationType:
+		return time.Duration(v.Int()).String(), nil
+	case v.Type() == urlType:
+		u := v.Interface().(url.URL)
+		return u.String(), nil
+	case isBytes(v.Type()):
+		return encodeBytes(v.Bytes(), false), nil
+	}
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return "", fmt.Errorf("cannot marshal nil %s", v.Type())
+		}
+		return formatScalar(v.Elem())
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 32), nil
+	case reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 64), nil
+	case reflect.Complex64, reflect.Complex128:
+		// Omit the parentheses, which would need quoting.
+		s := strconv.FormatComplex(v.Complex(), 'g', -1, v.Type().Bits())
+		return s[1 : len(s)-1], nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	default:
+		return "", fmt.Errorf("cannot marshal value of type %s", v.Type())
+	}
+}
+
+// linesFile returns a File holding each line of words.
+// Runs of two or more lines that begin with the same word
+// are grouped into a block with that word as the prefix.
+func linesFile(lines [][]string) *File {
+	var wls [][]Word
+	for _, l := range lines {
+		wls = append(wls, newWords(l))
+	}
+	return wordsFile(wls)
+}
+
+// wordsFile is like linesFile, for lines of Words.
+func wordsFile(lines [][]Word) *File {
+	f := &File{}
+	for len(lines) > 0 {
+		n := 1
+		if len(lines[0]) > 1 {
+			for n < len(lines) && len(lines[n]) > 1 && lines[n][0].Token == lines[0][0].Token {
+				n++
+			}
+		}
+		if n == 1 {
+			f.Stmts = append(f.Stmts, &Line{Words: lines[0]})
+		} else {
+			b := &Block{Prefix: lines[0][:1]}
+			for _, l := range lines[:n] {
+				b.Stmts = append(b.Stmts, &Line{Words: l[1:]})
+			}
+			f.Stmts = append(f.Stmts, b)
+		}
+		lines = lines[n:]
+	}
+	return f
+}
+
+// valueWords returns the words of v, keeping the quotation of those that were quoted.
+func valueWords(v Value) []Word {
+	var ws []Word
+	for i, w := range v.Words {
+		ws = append(ws, tokenWord(w, v.token(i)))
+	}
+	return ws
+}
+
+// lines returns a line for each node below n with no children, holding
+// the words of the nodes leading to it, keeping the quotation of those that were quoted.
+// The words of the nodes from the root to n are in path.
+func (n *Node) lines(path []Word, lines [][]Word) [][]Word {
+	if n == nil {
+		return lines
+	}
+	for _, c := range n.Children {
+		p := append(path[:len(path):len(path)], tokenWord(c.Word, c.Token))
+		if len(c.Children) == 0 {
+			lines = append(lines, p)
+		} else {
+			lines = c.lines(p, lines)
+		}
+	}
+	return lines
+}
+
+// tokenWord returns a Word for w. If token is a quoted string whose
+// value is w, it is written as token; otherwise it is quoted only if
+// necessary.
+func tokenWord(w, token string) Word {
+	if t := (Word{Token: token}); t.Quoted() {
+		if s, err := strconv.Unquote(token); err == nil && s == w {
+			return t
+		}
+	}
+	return Word{Token: quoteWord(w)}
+}
+
+// quoteWord returns w, quoted if it would not otherwise be read
+// back as a single word equal to w.
+func quoteWord(w string) string {
+	if needsQuote(w) {
+		return strconv.Quote(w)
+	}
+	return w
+}
+
+func needsQuote(w string) bool {
+	if w == "" {
+		return true
+	}
+	switch w[0] {
+	case '"', '`', '\\':
+		return true
+	}
+	if strings.HasPrefix(w, "//") {
+		return true
+	}
+	for _, r := range w {
+		if r == utf8.RuneError || unicode.IsSpace(r) || !unicode.IsPrint(r) {
+			return true
+		}
+		switch r {
+		case '(', ')', '{', '}', ';':
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,233 @@
+// Copyright 2024 by Jonathan Amsterdam.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package gdl
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMarshal(t *testing.T) {
+	type Arg struct {
+		Name, Type string
+	}
+
+	type command struct {
+		Name string `gdl:",id"`
+		Args []Arg
+	}
+
+	type file struct {
+		Requires []Require
+		Commands []command
+	}
+
+	type enum struct {
+		Name   string
+		Values []string
+	}
+
+	type scalars struct {
+		I int8
+		U uint
+		F float64
+		B bool
+		S string
+	}
+
+	type opt struct {
+		Name  *string
+		Count *int
+	}
+
+	type opts struct {
+		Module *string
+		Go     *int
+		Opts   []*opt
+	}
+
+	type service struct {
+		Port int
+		Metadata
+		*Timeouts
+	}
+
+	one := 1
+	s := "s"
+	lvl := info
+
+	for _, tc := range []struct {
+		in   any
+		want string
+	}{
+		{Require{"m", "v1"}, "m v1\n"},
+		{&Require{"a b", ""}, "\"a b\" \"\"\n"},
+		{enum{"color", []string{"red", "green"}}, "color red green\n"},
+		{scalars{-3, 4, 1.5, true, "x"}, "-3 4 1.5 true x\n"},
+		{file{}, ""},
+		{enum{"values", []string{"x"}}, "name values\nvalues x\n"},
+		{
+			goMod{Module: "m", Go: "1.23", Requires: []Require{{"m1", "v1"}}, Excludes: []string{"a", "b"}},
+			"module m\ngo 1.23\nrequire m1 v1\nexcludes a b\n",
+		},
+		{goMod{Module: "m"}, "module m\n"},
+		{opts{}, ""},
+		{
+			menu{Items: []menuItem{{Label: "File", Items: []menuItem{{Label: "New"}, {Label: "Open"}}}, {Label: "Edit"}}},
+			"item (\n\tFile item New\n\tFile item Open\n\tEdit\n)\n",
+		},
+		{service{Port: 80, Metadata: Metadata{"web", "bob"}}, "80 web bob\n"},
+		{service{80, Metadata{"web", "bob"}, &Timeouts{1}}, "80 web bob 1\n"},
+		{
+			opts{Module: &s, Go: &one, Opts: []*opt{{Name: &s}, {Name: &s, Count: &one}, {}}},
+			"module s\ngo 1\nopt (\n\ts\n\ts 1\n)\nopt\n",
+		},
+		{
+			appConfig{
+				Server:   serverConfig{Host: "h", Port: 1, TLS: &tlsConfig{Cert: "c"}},
+				Database: &database{Name: "main", User: "bob"},
+				Logging:  &struct{ Level string }{},
+			},
+			"server (\n\thost h\n\tport 1\n\ttLS  cert c\n)\ndatabase main user bob\nlogging\n",
+		},
+		{map[string]int{"b": 2, "a": 1}, "a 1\nb 2\n"},
+		{replace{"a", "b"}, "a \"\" b\n"},
+		{dependency{"d", warn, []constraint{{">=", "1"}, {"=", "2"}}}, "d warn >= 1 2\n"},
+		{pin{"p", &lvl, constraint{"<", "3"}}, "p info < 3\n"},
+		{positional{"m", [3]int{1, 2, 3}, []string{"x", "y"}, "", []string{"r"}}, "m 1 2 3 x y \"\" r\n"},
+		{access{Allow: []string{"a", "b"}, Deny: []string{"c"}}, "allow a b\ndeny c\n"},
+		{tagged{Tags: []string{"x"}, Name: "n"}, "tags x\nname n\n"},
+		{
+			cluster{
+				Name:      "c",
+				Databases: map[string]database{"main": {Name: "main", User: "bob"}, "logs": {Name: "logs"}},
+				Hosts:     map[string]*serverConfig{"h": {Port: 1}},
+				Env:       map[string]string{"A": "1"},
+				Groups:    map[string][]string{"g": {"x", "y"}},
+			},
+			"name c\ndatabase (\n\tlogs\n\tmain user bob\n)\nhost h port 1\nenv A 1\ngroup g x y\n",
+		},
+		{
+			file{Requires: []Require{{"m1", "v1"}}},
+			"require m1 v1\n",
+		},
+		{
+			file{Requires: []Require{{"m1", "v1"}, {"m2", "v2"}}},
+			"require (\n\tm1 v1\n\tm2 v2\n)\n",
+		},
+		{
+			file{
+				Requires: []Require{{"m1", "v1"}},
+				Commands: []command{
+					{Name: "create", Args: []Arg{{"name", "string"}, {"size", "int"}}},
+					{Name: "delete"},
+				},
+			},
+			"require m1 v1\n" +
+				"command (\n" +
+				"\tcreate arg name string\n" +
+				"\tcreate arg size int\n" +
+				"\tdelete\n" +
+				")\n",
+		},
+	} {
+		got, err := Marshal(tc.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("%+v:\ngot\n%s\nwant\n%s", tc.in, got, tc.want)
+			continue
+		}
+
+		// Round trip.
+		vals, err := Parse(string(got))
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := reflect.New(reflect.Indirect(reflect.ValueOf(tc.in)).Type())
+		if err := UnmarshalValues(vals, p.Interface()); err != nil {
+			t.Fatalf("%s: %v", got, err)
+		}
+		if g, w := vfmt.Sprint(p.Elem().Interface()), vfmt.Sprint(reflect.Indirect(reflect.ValueOf(tc.in)).Interface()); g != w {
+			t.Errorf("round trip of %q: got\n%s\nwant\n%s", got, g, w)
+		}
+	}
+}
+
+func TestMarshalValues(t *testing.T) {
+	const in = "a \"1\" 1 `b c`\n\"a\" \"true\"\n"
+	vals, err := Parse(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Marshal(vals)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != in {
+		t.Errorf("got\n%s\nwant\n%s", got, in)
+	}
+	vals2, err := Parse(string(got))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, w := vfmt.Sprint(vals2), vfmt.Sprint(vals); g != w {
+		t.Errorf("round trip: got %s, want %s", g, w)
+	}
+
+	// A tree keeps the quotation of its words too.
+	const treeIn = "a `x y` `b` \"\\x41\"\n"
+	vals, err = Parse(treeIn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = Marshal(Tree(vals))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != treeIn {
+		t.Errorf("tree: got %q, want %q", got, treeIn)
+	}
+}
+
+func TestMarshalError(t *testing.T) {
+	type opt struct {
+		Name  *string
+		Count int
+	}
+	type service struct {
+		*Timeouts
+		Port int
+	}
+	type rules struct {
+		Rules []tagged
+	}
+	for _, in := range []any{
+		1, "x", []Require{}, (*Require)(nil), opt{Count: 1}, service{Port: 1},
+		positional{Tags: []string{"x"}, Rest: []string{"y"}},
+		positional{Tags: []string{"x", "y", "z"}},
+		rules{[]tagged{{Tags: []string{"x"}}}}, rules{[]tagged{{Name: "n"}}},
+		struct{ A [1]Require }{},
+	} {
+		if _, err := Marshal(in); err == nil {
+			t.Errorf("%#v: got nil, want error", in)
+		}
+	}
+}
+
+func TestQuoteWord(t *testing.T) {
+	for _, w := range []string{
+		"", "x", "a b", "(", "a)", "a;b", `"`, "`", "\\", "//c", "a//b", "\t", "\n", "é", "a\"b",
+	} {
+		vals, err := Parse("x " + quoteWord(w))
+		if err != nil {
+			t.Fatalf("%q: %v", w, err)
+		}
+		if len(vals) != 1 || len(vals[0].Words) != 2 || vals[0].Words[1] != w {
+			t.Errorf("%q: quoted as %q, read back as %v", w, quoteWord(w), vals)
+		}
+	}
+}
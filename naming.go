@@ -0,0 +1,260 @@
+// Copyright 2024 by Jonathan Amsterdam.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package gdl
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// A Naming determines the keyword of a struct field that
+// doesn't have one in its tag.
+type Naming int
+
+const (
+	// CamelCase uses the field name with the first letter lower-cased,
+	// as in "maxConn" for MaxConn. It is the default.
+	CamelCase Naming = iota
+	// KebabCase uses the lower-cased words of the field name joined
+	// by hyphens, as in "max-conn".
+	KebabCase
+	// SnakeCase uses the lower-cased words of the field name joined
+	// by underscores, as in "max_conn".
+	SnakeCase
+	// CaseInsensitive is like CamelCase, but keywords match
+	// regardless of case, so "maxconn" and "MAXCONN" select MaxConn.
+	// Keywords from tags also match regardless of case.
+	CaseInsensitive
+)
+
+// A config holds the settings of a Decoder or Encoder that affect
+// how types are compiled. Programs are cached separately for each config.
+type config struct {
+	naming    Naming
+	jsonTags  bool               // use json tag names for fields without gdl tag names
+	convs     *converterRegistry // see Decoder.RegisterConverter; may be nil
+	boolWords bool               // see Decoder.AllowBoolWords
+}
+
+// keyword returns the keyword for a field named name.
+func (n Naming) keyword(name string) string {
+	switch n {
+	case KebabCase:
+		return strings.ToLower(strings.Join(splitWords(name), "-"))
+	case SnakeCase:
+		return strings.ToLower(strings.Join(splitWords(name), "_"))
+	default:
+		return lowerFirst(name)
+	}
+}
+
+// splitWords splits a Go identifier into words at changes of case, keeping
+// initialisms together: "MaxConn" becomes "Max", "Conn", and "TLSConfig"
+// becomes "TLS", "Config". Underscores also separate words.
+func splitWords(name string) []string {
+	var words []string
+	rs := []rune(name)
+	start := 0
+	for i := range rs {
+		if rs[i] == '_' {
+			if i > start {
+				words = append(words, string(rs[start:i]))
+			}
+			start = i + 1
+			continue
+		}
+		if i == start || !unicode.IsUpper(rs[i]) {
+			continue
+		}
+		prev := rs[i-1]
+		nextLower := i+1 < len(rs) && unicode.IsLower(rs[i+1])
+		if !unicode.IsUpper(prev) || nextLower {
+			words = append(words, string(rs[start:i]))
+			start = i
+		}
+	}
+	if start < len(rs) {
+		words = append(words, string(rs[start:]))
+	}
+	return words
+}
+
+// keywords returns the keywords that select sf under cfg.
+// The first is the one written by the Encoder.
+// The keywords of a field are the names in its gdl tag, separated by "|",
+// or, if there are none, the name in its json tag if cfg says to use it,
+// or else the keyword that cfg's Naming derives from the field name.
+func (cfg config) keywords(sf reflect.StructField) []string {
+	if names := tagKeywords(sf.Tag.Get("gdl")); len(names) > 0 {
+		return names
+	}
+	if cfg.jsonTags {
+		name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			return []string{name}
+		}
+	}
+	return []string{cfg.naming.keyword(sf.Name)}
+}
+
+// tagKeywords returns the keywords in the name part of a gdl tag,
+// or nil if there are none. A position is not a keyword.
+func tagKeywords(tag string) []string {
+	name, _, _ := strings.Cut(tag, ",")
+	if name == "" || name == "-" || isPositionTag(name) {
+		return nil
+	}
+	var kws []string
+	for _, kw := range strings.Split(name, "|") {
+		if kw = strings.TrimSpace(kw); kw != "" {
+			kws = append(kws, kw)
+		}
+	}
+	return kws
+}
+
+// fold returns the form of the keyword kw that is looked up.
+func (cfg config) fold(kw string) string {
+	if cfg.naming == CaseInsensitive {
+		return strings.ToLower(kw)
+	}
+	return kw
+}
+
+var (
+	pluralMu  sync.RWMutex
+	plurals   = map[string]string{} // singular to plural
+	singulars = map[string]string{} // plural to singular
+)
+
+func init() {
+	for _, p := range [][2]string{
+		{"alias", "aliases"},
+		{"analysis", "analyses"},
+		{"axis", "axes"},
+		{"bus", "buses"},
+		{"child", "children"},
+		{"criterion", "criteria"},
+		{"foot", "feet"},
+		{"goose", "geese"},
+		{"half", "halves"},
+		{"knife", "knives"},
+		{"leaf", "leaves"},
+		{"life", "lives"},
+		{"man", "men"},
+		{"mouse", "mice"},
+		{"person", "people"},
+		{"status", "statuses"},
+		{"tooth", "teeth"},
+		{"woman", "women"},
+	} {
+		RegisterPlural(p[0], p[1])
+	}
+}
+
+// RegisterPlural registers plural as the plural of singular.
+// A keyword for a slice or map field matches the singular of the
+// field's keyword as well as the keyword itself, and the Encoder writes
+// the singular form. Words with irregular plurals, like "child" and
+// "children", must be registered; many common ones already are.
+//
+// Both words should be in lower case. They match the last word of a
+// keyword in any of the styles of [Naming], so registering "child"
+// also covers "subChild" and "sub-child".
+//
+// RegisterPlural should be called during initialization,
+// before any types using the words are decoded or encoded.
+func RegisterPlural(singular, plural string) {
+	pluralMu.Lock()
+	defer pluralMu.Unlock()
+	plurals[singular] = plural
+	singulars[plural] = singular
+}
+
+// lastWord splits s into a prefix and its last word, which begins
+// after the last hyphen or underscore, or at the last upper-case letter.
+func lastWord(s string) (prefix, word string) {
+	i := strings.LastIndexFunc(s, func(r rune) bool {
+		return r == '-' || r == '_' || unicode.IsUpper(r)
+	})
+	if i < 0 {
+		return "", s
+	}
+	if s[i] == '-' || s[i] == '_' {
+		return s[:i+1], s[i+1:]
+	}
+	return s[:i], s[i:]
+}
+
+// irregular looks up the last word of s in m, preserving the case
+// of its first letter.
+func irregular(m map[string]string, s string) (string, bool) {
+	prefix, w := lastWord(s)
+	pluralMu.RLock()
+	r, ok := m[strings.ToLower(w)]
+	pluralMu.RUnlock()
+	if !ok {
+		return "", false
+	}
+	if f, _ := utf8.DecodeRuneInString(w); unicode.IsUpper(f) {
+		r = upperFirst(r)
+	}
+	return prefix + r, true
+}
+
+// plural returns the plural of s.
+func plural(s string) string {
+	if len(s) == 0 {
+		return s
+	}
+	if p, ok := irregular(plurals, s); ok {
+		return p
+	}
+	switch {
+	case strings.HasSuffix(s, "y") && len(s) > 1 && !strings.ContainsRune("aeiou", rune(s[len(s)-2])):
+		return s[:len(s)-1] + "ies"
+	case strings.HasSuffix(s, "s"), strings.HasSuffix(s, "x"), strings.HasSuffix(s, "z"),
+		strings.HasSuffix(s, "ch"), strings.HasSuffix(s, "sh"):
+		return s + "es"
+	default:
+		return s + "s"
+	}
+}
+
+// singular returns a word that [plural] maps to s, or s itself
+// if there is none.
+// Where both "es" and "s" could have been added, as in "boxes" and "databases",
+// it removes "es" only after "x", "ss", "ch" or "sh".
+func singular(s string) string {
+	if w, ok := irregular(singulars, s); ok {
+		return w
+	}
+	if w, ok := strings.CutSuffix(s, "ies"); ok && w != "" && plural(w+"y") == s {
+		return w + "y"
+	}
+	if w, ok := strings.CutSuffix(s, "es"); ok {
+		for _, suf := range []string{"x", "ss", "ch", "sh"} {
+			if strings.HasSuffix(w, suf) {
+				return w
+			}
+		}
+	}
+	if w, ok := strings.CutSuffix(s, "s"); ok && w != "" && plural(w) == s {
+		return w
+	}
+	return s
+}
+
+func upperFirst(s string) string {
+	if len(s) == 0 {
+		return s
+	}
+	rs := []rune(s)
+	rs[0] = unicode.ToUpper(rs[0])
+	return string(rs)
+}
@@ -0,0 +1,180 @@
+// Copyright 2024 by Jonathan Amsterdam.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package gdl
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type poolEntry struct {
+	Name   string `gdl:",id"`
+	Weight int
+}
+
+type pool struct {
+	MaxConn     int
+	IdleTimeout string
+	Entries     []poolEntry
+	Children    []string
+}
+
+func TestNaming(t *testing.T) {
+	want := pool{
+		MaxConn:     10,
+		IdleTimeout: "5s",
+		Entries:     []poolEntry{{"a", 1}, {"b", 2}},
+		Children:    []string{"x", "y"},
+	}
+	for _, tc := range []struct {
+		naming Naming
+		in     string
+	}{
+		{CamelCase, "maxConn 10\nidleTimeout 5s\nentry a 1\nentry b 2\nchild x\nchildren y\n"},
+		{KebabCase, "max-conn 10\nidle-timeout 5s\nentry a 1\nentries b 2\nchild x\nchild y\n"},
+		{SnakeCase, "max_conn 10\nidle_timeout 5s\nentry (\n\ta 1\n\tb 2\n)\nchild x y\n"},
+		{CaseInsensitive, "MAXCONN 10\nidletimeout 5s\nEntry a 1\nENTRY b 2\nChild x\nchild y\n"},
+	} {
+		d := NewDecoder(strings.NewReader(tc.in))
+		d.SetNaming(tc.naming)
+		var got pool
+		if err := d.Decode(&got); err != nil {
+			t.Fatalf("%d: %v", tc.naming, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%d: got %+v, want %+v", tc.naming, got, want)
+		}
+
+		// Round trip.
+		var buf bytes.Buffer
+		e := NewEncoder(&buf)
+		e.SetNaming(tc.naming)
+		if err := e.Encode(got); err != nil {
+			t.Fatal(err)
+		}
+		d = NewDecoder(&buf)
+		d.SetNaming(tc.naming)
+		var got2 pool
+		if err := d.Decode(&got2); err != nil {
+			t.Fatalf("%d: %v", tc.naming, err)
+		}
+		if !reflect.DeepEqual(got2, want) {
+			t.Errorf("%d: round trip: got %+v, want %+v", tc.naming, got2, want)
+		}
+	}
+
+	// The encoder writes keywords in the style of its Naming.
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	e.SetNaming(KebabCase)
+	if err := e.Encode(want); err != nil {
+		t.Fatal(err)
+	}
+	const wantOut = "max-conn 10\nidle-timeout 5s\nentry (\n\ta 1\n\tb 2\n)\nchildren x y\n"
+	if got := buf.String(); got != wantOut {
+		t.Errorf("kebab-case encoding:\ngot\n%s\nwant\n%s", got, wantOut)
+	}
+}
+
+func TestTagKeywords(t *testing.T) {
+	type listener struct {
+		Addr    string `gdl:"listen|bind"`
+		MaxConn int    `gdl:"max-conn"`
+		Timeout int    `json:"timeout_sec,omitempty"`
+		Skip    int    `json:"-"`
+	}
+	d := NewDecoder(strings.NewReader("bind :80\nmax-conn 3\ntimeout_sec 5\nskip 1\n"))
+	d.UseJSONTags()
+	var got listener
+	if err := d.Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	want := listener{":80", 3, 5, 1}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	// The first keyword in the tag is written.
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	e.UseJSONTags()
+	if err := e.Encode(struct {
+		listener
+		TLS *tlsConfig `gdl:"tls"`
+	}{got, &tlsConfig{Cert: "c"}}); err != nil {
+		t.Fatal(err)
+	}
+	const wantOut = "listen :80\nmax-conn 3\ntimeout_sec 5\nskip 1\ntls cert c\n"
+	if got := buf.String(); got != wantOut {
+		t.Errorf("got\n%s\nwant\n%s", got, wantOut)
+	}
+
+	// Without UseJSONTags, the json name is not a keyword,
+	// so the words are matched by position.
+	d = NewDecoder(strings.NewReader("timeout_sec 5"))
+	got = listener{}
+	if err := d.Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if want := (listener{Addr: "timeout_sec", MaxConn: 5}); got != want {
+		t.Errorf("without json tags: got %+v, want %+v", got, want)
+	}
+}
+
+func TestTagKeywordsError(t *testing.T) {
+	type dup struct {
+		A int `gdl:"x"`
+		B int `gdl:"y|x"`
+	}
+	matchError(t, "dup", UnmarshalValues([]Value{{Words: []string{"1"}}}, &dup{}), `keyword "x" of field B is already used by field A`)
+}
+
+func TestPlural(t *testing.T) {
+	RegisterPlural("cactus", "cacti")
+	for _, tc := range []struct {
+		singular, plural string
+	}{
+		{"require", "requires"},
+		{"box", "boxes"},
+		{"class", "classes"},
+		{"database", "databases"},
+		{"branch", "branches"},
+		{"entry", "entries"},
+		{"key", "keys"},
+		{"child", "children"},
+		{"Person", "People"},
+		{"subChild", "subChildren"},
+		{"sub-child", "sub-children"},
+		{"alias", "aliases"},
+		{"cactus", "cacti"},
+	} {
+		if got := plural(tc.singular); got != tc.plural {
+			t.Errorf("plural(%q) = %q, want %q", tc.singular, got, tc.plural)
+		}
+		if got := singular(tc.plural); got != tc.singular {
+			t.Errorf("singular(%q) = %q, want %q", tc.plural, got, tc.singular)
+		}
+	}
+}
+
+func TestSplitWords(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want string
+	}{
+		{"MaxConn", "Max Conn"},
+		{"TLSConfig", "TLS Config"},
+		{"HTTPPort2", "HTTP Port2"},
+		{"ID", "ID"},
+		{"userID", "user ID"},
+		{"Max_Conn", "Max Conn"},
+	} {
+		if got := strings.Join(splitWords(tc.in), " "); got != tc.want {
+			t.Errorf("splitWords(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
@@ -9,162 +9,404 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"slices"
 	"strconv"
 )
 
-// ParseFile calls [Parse] on the contents of the file.
+// ParseFile parses the contents of the file, as with [Parse].
 func ParseFile(filename string) ([]Value, error) {
-	data, err := os.ReadFile(filename)
+	f, err := os.Open(filename)
 	if err != nil {
 		return nil, err
 	}
-	return parse(string(data), filename)
+	defer f.Close()
+	var vals []Value
+	for v, err := range NewDecoder(f).All() {
+		if err != nil {
+			return nil, err
+		}
+		vals = append(vals, v)
+	}
+	return vals, nil
 }
 
 // Parse parses the string and returns one Line per logical line.
+// Errors in the syntax of s are reported as a [*SyntaxError].
 func Parse(s string) ([]Value, error) {
 	return parse(s, "<no file>")
 }
 
-func parse(s, filename string) (_ []Value, err error) {
-	lex := newLexer(s, filename)
+func parse(s, filename string) ([]Value, error) {
+	f, err := parseSyntax(s, filename)
+	if err != nil {
+		return nil, err
+	}
+	return f.Values(), nil
+}
+
+// ParseSyntax parses data, the contents of the named file, into a syntax tree.
+func ParseSyntax(filename string, data []byte) (*File, error) {
+	return parseSyntax(string(data), filename)
+}
+
+func parseSyntax(s, filename string) (_ *File, err error) {
+	p := newParser(newLexer(s, filename))
+	p.src = s
+	p.keepSrc = true
 
 	defer func() {
 		if err != nil {
-			err = fmt.Errorf("%s:%d: %w", filename, lex.lineno, err)
+			err = p.wrapErr(err)
 		}
 	}()
 
-	var vals []Value
-
+	f := &File{Name: filename}
 	for {
-		tok := skipNewlines(lex)
-		switch tok.kind {
-		case tokEOF:
-			return vals, nil
-		case ')':
-			return nil, errors.New("unexpected close paren")
-		default:
-			vs, err := parseValues(tok, lex)
-			if err != nil {
+		it, err := p.item()
+		if err != nil {
+			return nil, err
+		}
+		switch it.kind {
+		case itemEOF:
+			f.After = p.takeComments()
+			if p.keepSrc {
+				f.trailer = &nodeSrc{lead: p.src[p.segStart:], before: commentTokens(f.After)}
+			}
+			return f, nil
+		case itemLine:
+			f.Stmts = append(f.Stmts, it.line)
+		case itemOpen:
+			if err := p.blockBody(it.block); err != nil {
 				return nil, err
 			}
-			vals = append(vals, vs...)
+			f.Stmts = append(f.Stmts, it.block)
+		}
+	}
+}
+
+type parser struct {
+	lex      *lexer
+	comments []Comment // whole-line comments not yet attached to a node
+	midline  bool      // a token other than a comment has been seen on the current line
+	lastPos  Position  // position of the last token, for errors
+	blocks   []*Block  // blocks that have been opened but not closed
+
+	// If keepSrc is set, the parser records the source text of each node,
+	// so that unmodified nodes can be printed exactly as they were read.
+	// Each byte of src belongs to exactly one node; segStart is the offset
+	// of the first byte that has not yet been assigned.
+	keepSrc  bool
+	src      string
+	segStart int
+}
+
+func newParser(lex *lexer) *parser {
+	lex.keepComments = true
+	return &parser{lex: lex}
+}
+
+// wrapErr returns err as a *SyntaxError at the current position.
+// Errors reading the input are returned as is.
+func (p *parser) wrapErr(err error) error {
+	if err == p.lex.readErr {
+		return err
+	}
+	e := &SyntaxError{File: p.lex.filename, Line: p.lex.lineno, Err: err}
+	if p.lastPos.Line == e.Line {
+		e.Column = p.lastPos.Col
+	}
+	return e
+}
+
+// skipLine discards the rest of the line on which an error occurred,
+// so that parsing can resume at the start of the next line.
+// It reports whether there may be more input.
+func (p *parser) skipLine() bool {
+	l := p.lex
+	if p.midline && !(l.ungotten && l.untok.kind == '\n') {
+		l.skipLine()
+	} else {
+		// The error occurred at the end of the line.
+		l.ungotten = false
+		l.errtok = token{}
+	}
+	p.midline = false
+	return l.s != "" || l.r != nil
+}
+
+// An item is the unit of syntax returned by parser.item.
+type item struct {
+	kind  itemKind
+	line  *Line  // for itemLine
+	block *Block // for itemOpen and itemClose
+}
+
+type itemKind int
+
+const (
+	itemEOF   itemKind = iota
+	itemLine           // a complete line
+	itemOpen           // the prefix and open paren of a block
+	itemClose          // the close paren of a block
+)
+
+// item returns the next item of the input.
+// For itemOpen, the block's statements have not been parsed;
+// they are the following items, up to the matching itemClose,
+// which returns the same block.
+func (p *parser) item() (item, error) {
+	tok := p.next()
+	for tok.kind == '\n' {
+		tok = p.next()
+	}
+	switch tok.kind {
+	case tokEOF:
+		if len(p.blocks) > 0 {
+			return item{}, io.ErrUnexpectedEOF
+		}
+		return item{kind: itemEOF}, nil
+	case ')':
+		if len(p.blocks) == 0 {
+			return item{}, errors.New("unexpected close paren")
+		}
+		b := p.blocks[len(p.blocks)-1]
+		p.blocks = p.blocks[:len(p.blocks)-1]
+		if err := p.closeParen(b, tok); err != nil {
+			return item{}, err
 		}
+		return item{kind: itemClose, block: b}, nil
+	case '}', ']':
+		if len(p.blocks) > 0 {
+			return item{}, errors.New("mismatched close delimiter")
+		}
+		return item{}, fmt.Errorf("unexpected %q", tok.kind)
 	}
+	return p.stmtItem(tok)
 }
 
-// Called at line start. Ends at the next line start or EOF.
-// Only called when there is a value.
-func parseValues(tok token, lex *lexer) ([]Value, error) {
-	var words []string
+// stmtItem returns the line or open block beginning with tok.
+// It is called at line start, and ends at the next line start or EOF,
+// just before a close delimiter, or after an open paren.
+func (p *parser) stmtItem(tok token) (item, error) {
+	line := &Line{Start: tok.pos}
+	line.Before = p.takeComments()
+	start := tok.pos.Offset
+	lastEnd := start // end of the last word or comment
 	for {
 		switch tok.kind {
 		case tokEOF:
-			// Accept a value that isn't followed by a newline.
-			if len(words) > 0 {
-				return []Value{newValue(words, lex)}, nil
+			// Accept a line that isn't followed by a newline.
+			if len(line.Words) > 0 {
+				p.setLineSrc(line, start, lastEnd, tok.pos.Offset)
+				return item{kind: itemLine, line: line}, nil
 			}
-			return nil, io.ErrUnexpectedEOF
+			return item{}, io.ErrUnexpectedEOF
 
 		case '\n':
-			if len(words) > 0 {
-				return []Value{newValue(words, lex)}, nil
+			if len(line.Words) > 0 {
+				p.setLineSrc(line, start, lastEnd, tok.end.Offset)
+				return item{kind: itemLine, line: line}, nil
 			}
-			return nil, errors.New("unexpected newline")
+			return item{}, errors.New("unexpected newline")
 
 		case tokWord:
-			words = append(words, tok.val)
+			line.Words = append(line.Words, Word{Start: tok.pos, Token: tok.val})
+			line.End = tok.end
+			lastEnd = tok.end.Offset
 
 		case tokString:
-			unq, err := strconv.Unquote(tok.val)
-			if err != nil {
-				return nil, err
+			if _, err := strconv.Unquote(tok.val); err != nil {
+				return item{}, err
 			}
-			words = append(words, unq)
+			line.Words = append(line.Words, Word{Start: tok.pos, Token: tok.val})
+			line.End = tok.end
+			lastEnd = tok.end.Offset
+
+		case tokComment:
+			line.Suffix = append(line.Suffix, Comment{Start: tok.pos, Token: tok.val})
+			lastEnd = tok.end.Offset
 
 		case '(':
-			list, err := parseList(lex, ')')
-			if err != nil {
-				return nil, err
+			b := &Block{
+				Comments: Comments{Before: line.Before},
+				Start:    line.Start,
+				Prefix:   line.Words,
+				LParen:   LParen{Pos: tok.pos},
 			}
-			var vals []Value
-			for _, lv := range list {
-				vals = append(vals, newValue(slices.Concat(words, lv.Words), lex))
+			if p.keepSrc {
+				b.open = &nodeSrc{
+					lead:   p.src[p.segStart:start],
+					before: commentTokens(b.Before),
+				}
 			}
-			return vals, nil
+			p.openParen(b, start)
+			p.blocks = append(p.blocks, b)
+			return item{kind: itemOpen, block: b}, nil
 
 		case ')', '}', ']':
-			if len(words) == 0 {
-				panic("bad close delimiter")
+			if len(line.Words) == 0 {
+				return item{}, fmt.Errorf("unexpected %q", tok.kind)
 			}
 			// We're here after getting b in something like
 			//    (a; b)
 			// The close delim is part of the enclosing list.
-			lex.unget(tok)
-			return []Value{newValue(words, lex)}, nil
-
-		// case '{':
-		// 	list, err := parseList(lex, '}')
-		// 	if err != nil {
-		// 		return nil, err
-		// 	}
-		// 	return []Value{newValue(head, list, lex)}, nil
+			p.lex.unget(tok)
+			p.setLineSrc(line, start, lastEnd, lastEnd)
+			return item{kind: itemLine, line: line}, nil
 
 		case tokErr:
-			return nil, tok.err
+			return item{}, tok.err
 
 		default:
-			panic("bad token kind")
+			return item{}, fmt.Errorf("unexpected %q", tok.kind)
 		}
-		tok = lex.next()
+		tok = p.next()
 	}
 }
 
-// Called just after open delimiter. Ends just after close delimiter.
-// Works for parens, braces and square brackets.
-func parseList(lex *lexer, close rune) ([]Value, error) {
-	var vs []Value
+// stmt parses a complete statement.
+func (p *parser) stmt() (Stmt, error) {
+	it, err := p.item()
+	if err != nil {
+		return nil, err
+	}
+	switch it.kind {
+	case itemLine:
+		return it.line, nil
+	case itemOpen:
+		if err := p.blockBody(it.block); err != nil {
+			return nil, err
+		}
+		return it.block, nil
+	default:
+		return nil, io.ErrUnexpectedEOF
+	}
+}
+
+// blockBody parses the statements of b, up to and including its close paren.
+func (p *parser) blockBody(b *Block) error {
 	for {
-		tok := skipNewlines(lex)
-		switch tok.kind {
-		case tokEOF:
-			return nil, io.ErrUnexpectedEOF
-		case close:
-			k := lex.peek()
-			switch k {
-			case tokErr:
-				return nil, lex.next().err
-			case close, '\n', tokEOF:
-				return vs, nil
-			default:
-				return nil, errors.New("close delimiter must be followed by newline, EOF or another close delimiter")
+		it, err := p.item()
+		if err != nil {
+			return err
+		}
+		switch it.kind {
+		case itemLine:
+			b.Stmts = append(b.Stmts, it.line)
+		case itemOpen:
+			if err := p.blockBody(it.block); err != nil {
+				return err
 			}
-		case ')', '}', ']':
-			return nil, errors.New("mismatched close delimiter")
+			b.Stmts = append(b.Stmts, it.block)
+		case itemClose:
+			b.nstmt = len(b.Stmts)
+			return nil
 		}
-		vs1, err := parseValues(tok, lex)
-		if err != nil {
-			return nil, err
+	}
+}
+
+// setLineSrc records the source of a line that starts at offset start,
+// whose last token ends at lastEnd, and whose terminator ends at end.
+func (p *parser) setLineSrc(line *Line, start, lastEnd, end int) {
+	if !p.keepSrc {
+		return
+	}
+	line.src = &nodeSrc{
+		lead:   p.src[p.segStart:start],
+		before: commentTokens(line.Before),
+		body:   p.src[start:end],
+		tokens: lineTokens(line),
+		tail:   p.src[lastEnd:end],
+	}
+	p.segStart = end
+}
+
+// openParen is called just after the open paren of a block that starts at offset start.
+// It consumes the comment following the paren and the newline after that,
+// if they are present.
+func (p *parser) openParen(b *Block, start int) {
+	lastEnd := b.LParen.Pos.Offset + 1
+	if p.lex.peek() == tokComment {
+		c := p.next()
+		b.LParen.Suffix = append(b.LParen.Suffix, Comment{Start: c.pos, Token: c.val})
+		lastEnd = c.end.Offset
+	}
+	end := lastEnd
+	if p.lex.peek() == '\n' {
+		end = p.next().end.Offset
+	}
+	if p.keepSrc {
+		b.open.body = p.src[start:end]
+		b.open.tokens = openTokens(b)
+		b.open.tail = p.src[lastEnd:end]
+		p.segStart = end
+	}
+}
+
+// closeParen is called just after tok, the close paren of b.
+// It consumes the comment following the paren and the newline after that,
+// if they are present.
+func (p *parser) closeParen(b *Block, tok token) error {
+	b.RParen = RParen{Pos: tok.pos}
+	b.RParen.Before = p.takeComments()
+	lastEnd := tok.end.Offset
+	switch p.lex.peek() {
+	case tokErr:
+		return p.next().err
+	case ')', '\n', tokEOF:
+	case tokComment:
+		c := p.next()
+		b.RParen.Suffix = append(b.RParen.Suffix, Comment{Start: c.pos, Token: c.val})
+		lastEnd = c.end.Offset
+	default:
+		// Report the error at the token that follows, not at the close delimiter.
+		p.lastPos = p.lex.untok.pos
+		return errors.New("close delimiter must be followed by newline, EOF or another close delimiter")
+	}
+	end := lastEnd
+	switch p.lex.peek() {
+	case '\n':
+		end = p.next().end.Offset
+	case tokEOF:
+		end = p.lex.end
+	}
+	if p.keepSrc {
+		b.close = &nodeSrc{
+			lead:   p.src[p.segStart:tok.pos.Offset],
+			before: commentTokens(b.RParen.Before),
+			body:   p.src[tok.pos.Offset:end],
+			tokens: commentTokens(b.RParen.Suffix),
+			tail:   p.src[lastEnd:end],
 		}
-		vs = append(vs, vs1...)
+		p.segStart = end
 	}
+	return nil
 }
 
-func skipNewlines(lex *lexer) token {
+// next returns the next token from the lexer, collecting whole-line comments.
+// Suffix comments are returned to the caller.
+func (p *parser) next() token {
 	for {
-		tok := lex.next()
-		if tok.kind != '\n' {
-			return tok
+		tok := p.lex.next()
+		p.lastPos = tok.pos
+		switch tok.kind {
+		case tokComment:
+			if p.midline {
+				return tok
+			}
+			p.comments = append(p.comments, Comment{Start: tok.pos, Token: tok.val})
+			continue
+		case '\n':
+			p.midline = false
+		default:
+			p.midline = true
 		}
+		return tok
 	}
 }
 
-func newValue(words []string, lex *lexer) Value {
-	return Value{
-		Words: words,
-		File:  lex.filename,
-		Line:  lex.lineno,
-	}
+// takeComments returns the pending whole-line comments and clears them.
+func (p *parser) takeComments() []Comment {
+	cs := p.comments
+	p.comments = nil
+	return cs
 }
@@ -6,13 +6,14 @@ package gdl
 
 import (
 	"path"
+	"slices"
 	"testing"
 
 	"github.com/jba/format"
 	"rsc.io/diff"
 )
 
-var vfmt = format.New().IgnoreFields(Value{}, "File", "Line")
+var vfmt = format.New().IgnoreFields(Value{}, "File", "Line", "Start", "End", "WordPos")
 
 func TestParseValues(t *testing.T) {
 	for _, tc := range []struct {
@@ -64,12 +65,13 @@ func TestParseValues(t *testing.T) {
 			},
 		},
 	} {
-		lex := newLexer(tc.in, "tc")
-		got, err := parseValues(lex.next(), lex)
+		p := newParser(newLexer(tc.in, "tc"))
+		s, err := p.stmt()
 		if err != nil {
 			t.Errorf("%s: %v", tc.in, err)
 			continue
 		}
+		got := appendValues(nil, []Stmt{s}, nil, "tc")
 		gf := vfmt.Sprint(got)
 		wf := vfmt.Sprint(tc.want)
 		if gf != wf {
@@ -87,8 +89,8 @@ func TestParseValueError(t *testing.T) {
 		{"(\n) x", "close * must be followed"},
 		{"(\n} x", "mismatch"},
 	} {
-		lex := newLexer(tc.in, "tc")
-		_, err := parseValues(lex.next(), lex)
+		p := newParser(newLexer(tc.in, "tc"))
+		_, err := p.stmt()
 		matchError(t, tc.in, err, tc.want)
 	}
 }
@@ -152,6 +154,13 @@ func TestParse(t *testing.T) {
 				{Words: []string{"c", "d"}},
 			},
 		},
+		{
+			in: "\"x\" (1 \"1\"; `true` true)",
+			want: []Value{
+				{Words: []string{"x", "1", "1"}, Tokens: []string{`"x"`, "1", `"1"`}},
+				{Words: []string{"x", "true", "true"}, Tokens: []string{`"x"`, "`true`", "true"}},
+			},
+		},
 	} {
 		got, err := Parse(tc.in)
 		if tc.wantErr != "" {
@@ -178,3 +187,48 @@ func matchError(t *testing.T, prefix string, err error, glob string) {
 		t.Errorf("%s:\ngot error %q\nwant it to match %q", prefix, err, glob)
 	}
 }
+
+func TestParsePositions(t *testing.T) {
+	in := "a b\nreq (\n\tm1 v1\n\tm2 v2\n)\nx (y \\\n  z)"
+	vals, err := Parse(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type pos struct{ line, col int }
+	want := []struct {
+		line     int
+		start    pos
+		end      pos
+		wordPoss []pos
+	}{
+		{1, pos{1, 1}, pos{1, 4}, []pos{{1, 1}, {1, 3}}},
+		{3, pos{3, 2}, pos{3, 7}, []pos{{2, 1}, {3, 2}, {3, 5}}},
+		{4, pos{4, 2}, pos{4, 7}, []pos{{2, 1}, {4, 2}, {4, 5}}},
+		{6, pos{6, 4}, pos{7, 4}, []pos{{6, 1}, {6, 4}, {7, 3}}},
+	}
+	if len(vals) != len(want) {
+		t.Fatalf("got %d values, want %d", len(vals), len(want))
+	}
+	for i, v := range vals {
+		w := want[i]
+		if v.Line != w.line {
+			t.Errorf("%v: line: got %d, want %d", v.Words, v.Line, w.line)
+		}
+		if g := (pos{v.Start.Line, v.Start.Col}); g != w.start {
+			t.Errorf("%v: start: got %v, want %v", v.Words, g, w.start)
+		}
+		if g := (pos{v.End.Line, v.End.Col}); g != w.end {
+			t.Errorf("%v: end: got %v, want %v", v.Words, g, w.end)
+		}
+		var gps []pos
+		for _, p := range v.WordPos {
+			gps = append(gps, pos{p.Line, p.Col})
+		}
+		if !slices.Equal(gps, w.wordPoss) {
+			t.Errorf("%v: word positions: got %v, want %v", v.Words, gps, w.wordPoss)
+		}
+	}
+	if got, want := vals[1].PosOf(2), "<no file>:3:5"; got != want {
+		t.Errorf("PosOf: got %q, want %q", got, want)
+	}
+}
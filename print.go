@@ -0,0 +1,208 @@
+// Copyright 2024 by Jonathan Amsterdam.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package gdl
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+)
+
+// Bytes returns the text of the file.
+// Nodes that have not changed since the file was parsed are written exactly
+// as they were read, including their comments and layout.
+// New and modified nodes are written in a standard form.
+// They are indented like the statements around them, or with tabs if
+// there are none.
+func (f *File) Bytes() []byte {
+	var pr printer
+	pr.stmts(f.Stmts, 0)
+	if f.trailer.leadOK(f.After) {
+		pr.WriteString(f.trailer.lead)
+	} else {
+		pr.comments(f.After, 0)
+	}
+	return pr.Bytes()
+}
+
+type printer struct {
+	bytes.Buffer
+	indents map[int]string // indentation of the statements at each depth, as found in the source
+}
+
+func (pr *printer) stmts(stmts []Stmt, depth int) {
+	for _, s := range stmts {
+		switch s := s.(type) {
+		case *Line:
+			pr.line(s, depth)
+		case *Block:
+			pr.block(s, depth)
+		}
+	}
+}
+
+func (pr *printer) line(l *Line, depth int) {
+	pr.lead(l.src, l.Before, depth)
+	if l.src.bodyOK(lineTokens(l)) {
+		pr.WriteString(l.src.body)
+		return
+	}
+	pr.words(l.Words)
+	pr.suffix(l.Suffix)
+	pr.tail(l.src, l.Suffix)
+}
+
+func (pr *printer) block(b *Block, depth int) {
+	pr.lead(b.open, b.Before, depth)
+	if b.open.bodyOK(openTokens(b)) {
+		pr.WriteString(b.open.body)
+	} else {
+		pr.words(b.Prefix)
+		if len(b.Prefix) > 0 {
+			pr.WriteByte(' ')
+		}
+		pr.WriteByte('(')
+		pr.suffix(b.LParen.Suffix)
+		pr.tail(b.open, b.LParen.Suffix)
+	}
+	old, had := pr.indents[depth+1]
+	if ind, ok := stmtsIndent(b.Stmts); ok {
+		if pr.indents == nil {
+			pr.indents = map[int]string{}
+		}
+		pr.indents[depth+1] = ind
+	}
+	pr.stmts(b.Stmts, depth+1)
+	if had {
+		pr.indents[depth+1] = old
+	} else {
+		delete(pr.indents, depth+1)
+	}
+	if b.close.leadOK(b.RParen.Before) {
+		pr.WriteString(b.close.lead)
+	} else {
+		pr.comments(b.RParen.Before, depth+1)
+		pr.indent(depth)
+	}
+	if b.close.bodyOK(commentTokens(b.RParen.Suffix)) {
+		pr.WriteString(b.close.body)
+	} else {
+		pr.WriteByte(')')
+		pr.suffix(b.RParen.Suffix)
+		pr.tail(b.close, b.RParen.Suffix)
+	}
+}
+
+// lead writes the text before a node: the original text if the node's
+// comments are unchanged, otherwise the comments followed by indentation.
+func (pr *printer) lead(src *nodeSrc, before []Comment, depth int) {
+	if src.leadOK(before) {
+		pr.WriteString(src.lead)
+		return
+	}
+	pr.startLine()
+	if src != nil && strings.HasPrefix(strings.TrimLeft(src.lead, " \t"), "\n") {
+		// Keep the blank line that preceded the node.
+		pr.WriteByte('\n')
+	}
+	pr.comments(before, depth)
+	pr.indent(depth)
+}
+
+// comments writes each comment on its own line.
+func (pr *printer) comments(cs []Comment, depth int) {
+	if len(cs) == 0 {
+		return
+	}
+	pr.startLine()
+	for _, c := range cs {
+		pr.indent(depth)
+		pr.WriteString(c.Token)
+		pr.WriteByte('\n')
+	}
+}
+
+// tail writes the text that ends a modified node: what originally followed
+// its last token, unless that would not end the line after a comment.
+func (pr *printer) tail(src *nodeSrc, suffix []Comment) {
+	if src != nil && src.body != "" && (len(suffix) == 0 || strings.Contains(src.tail, "\n")) {
+		pr.WriteString(src.tail)
+		return
+	}
+	pr.WriteByte('\n')
+}
+
+func (pr *printer) words(ws []Word) {
+	for i, w := range ws {
+		if i > 0 {
+			pr.WriteByte(' ')
+		}
+		pr.WriteString(w.Token)
+	}
+}
+
+func (pr *printer) suffix(cs []Comment) {
+	for _, c := range cs {
+		pr.WriteByte(' ')
+		pr.WriteString(c.Token)
+	}
+}
+
+// indent writes the indentation for a new node at depth: that of the
+// node's siblings in the source, or else a tab per level.
+func (pr *printer) indent(depth int) {
+	if ind, ok := pr.indents[depth]; ok {
+		pr.WriteString(ind)
+		return
+	}
+	for range depth {
+		pr.WriteByte('\t')
+	}
+}
+
+// stmtsIndent returns the indentation of the first of stmts that began
+// a line in the source, and whether there is one.
+func stmtsIndent(stmts []Stmt) (string, bool) {
+	for _, s := range stmts {
+		var src *nodeSrc
+		var start Position
+		switch s := s.(type) {
+		case *Line:
+			src, start = s.src, s.Start
+		case *Block:
+			src, start = s.open, s.Start
+		}
+		if src == nil || src.body == "" {
+			continue
+		}
+		// The lead runs from the end of the previous node, which may
+		// or may not have ended its line.
+		lead := src.lead
+		if i := strings.LastIndexByte(lead, '\n'); i >= 0 {
+			lead = lead[i+1:]
+		} else if len(lead) != start.Col-1 {
+			continue
+		}
+		return lead, true
+	}
+	return "", false
+}
+
+// startLine starts a new line, unless the output is already at the start of one.
+func (pr *printer) startLine() {
+	if pr.Len() > 0 && pr.Bytes()[pr.Len()-1] != '\n' {
+		pr.WriteByte('\n')
+	}
+}
+
+// leadOK reports whether the original text before the node can be used.
+func (s *nodeSrc) leadOK(before []Comment) bool {
+	return s != nil && slices.Equal(s.before, commentTokens(before))
+}
+
+// bodyOK reports whether the original text of the node can be used.
+func (s *nodeSrc) bodyOK(tokens []string) bool {
+	return s != nil && s.body != "" && slices.Equal(s.tokens, tokens)
+}
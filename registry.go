@@ -0,0 +1,173 @@
+// Copyright 2024 by Jonathan Amsterdam.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package gdl
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+	"sync"
+)
+
+// A Registry holds the types registered with [RegisterType].
+// [*Decoder] and [*Encoder] are Registries.
+type Registry interface {
+	registry() *typeRegistry
+}
+
+func (d *Decoder) registry() *typeRegistry { return &d.types }
+func (e *Encoder) registry() *typeRegistry { return &e.types }
+
+// RegisterType registers the type of v, which must be a struct or a pointer to a struct,
+// under name as an implementation of the interface type I.
+//
+// When a Decoder with registered types unmarshals into a field of type I or []I,
+// the word after the field's keyword is the name of the concrete type, and the
+// remaining words are unmarshaled into a new value of that type. For example, after
+//
+//	RegisterType[Shape](dec, "circle", Circle{})
+//
+// the line
+//
+//	shape circle 3
+//
+// appends a Circle to a field named Shapes of type []Shape, unmarshaling
+// "3" into it as for a slice of structs.
+// If v is a pointer, the field is set to a pointer to the new value.
+// In a field tagged `gdl:",statements"`, the name itself is the keyword;
+// see [UnmarshalValues].
+//
+// When an Encoder marshals such a field, it writes the name registered for
+// the value's type after the keyword.
+//
+// RegisterType panics if v is not a struct or pointer to struct, or if the
+// name or type is already registered for I.
+func RegisterType[I any](r Registry, name string, v I) {
+	it := reflect.TypeFor[I]()
+	if it.Kind() != reflect.Interface {
+		panic(fmt.Sprintf("gdl.RegisterType: %s is not an interface type", it))
+	}
+	t := reflect.TypeOf(v)
+	if t == nil {
+		panic("gdl.RegisterType: nil value")
+	}
+	st := t
+	if st.Kind() == reflect.Pointer {
+		st = st.Elem()
+	}
+	if st.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("gdl.RegisterType: %s is not a struct or pointer to struct", t))
+	}
+	r.registry().register(it, name, t)
+}
+
+// A typeRegistry maps names to the concrete types of interfaces, and back.
+type typeRegistry struct {
+	byName map[reflect.Type]map[string]reflect.Type // interface type to name to concrete type
+	byType map[reflect.Type]map[reflect.Type]string // interface type to concrete type to name
+}
+
+func (r *typeRegistry) register(it reflect.Type, name string, t reflect.Type) {
+	if r.byName == nil {
+		r.byName = map[reflect.Type]map[string]reflect.Type{}
+		r.byType = map[reflect.Type]map[reflect.Type]string{}
+	}
+	if r.byName[it] == nil {
+		r.byName[it] = map[string]reflect.Type{}
+		r.byType[it] = map[reflect.Type]string{}
+	}
+	if _, ok := r.byName[it][name]; ok {
+		panic(fmt.Sprintf("gdl.RegisterType: name %q already registered for %s", name, it))
+	}
+	if _, ok := r.byType[it][t]; ok {
+		panic(fmt.Sprintf("gdl.RegisterType: type %s already registered for %s", t, it))
+	}
+	r.byName[it][name] = t
+	r.byType[it][t] = name
+}
+
+// lookup returns the concrete type registered under name for the interface type it.
+// It returns nil if there is none. r may be nil.
+func (r *typeRegistry) lookup(it reflect.Type, name string) reflect.Type {
+	if r == nil {
+		return nil
+	}
+	return r.byName[it][name]
+}
+
+// name returns the name registered for the concrete type t as an implementation
+// of the interface type it, and whether there is one. r may be nil.
+func (r *typeRegistry) name(it, t reflect.Type) (string, bool) {
+	if r == nil {
+		return "", false
+	}
+	name, ok := r.byType[it][t]
+	return name, ok
+}
+
+// RegisterConverter registers f, which must be a function of type
+// func(string) (T, error) for some type T, to convert words to values of T.
+// After
+//
+//	dec.RegisterConverter(uuid.Parse)
+//
+// [Decoder.Decode] sets fields of type uuid.UUID, and the elements of slices and
+// arrays and the values of maps of that type, by calling uuid.Parse on a word,
+// as it does for strings and numbers. A converter takes precedence over the
+// other ways of unmarshaling T, including its UnmarshalText or UnmarshalGDL method.
+//
+// Types are compiled separately for each Decoder with converters, so
+// converters registered with one Decoder do not affect any other.
+//
+// RegisterConverter panics if f is not a function of the right type,
+// or if a converter for T is already registered.
+func (d *Decoder) RegisterConverter(f any) {
+	fv := reflect.ValueOf(f)
+	ft := reflect.TypeOf(f)
+	if ft == nil || ft.Kind() != reflect.Func ||
+		ft.NumIn() != 1 || ft.In(0) != reflect.TypeFor[string]() ||
+		ft.NumOut() != 2 || ft.Out(1) != reflect.TypeFor[error]() {
+		panic(fmt.Sprintf("gdl.RegisterConverter: %T is not a func(string) (T, error)", f))
+	}
+	t := ft.Out(0)
+	// Programs compiled with the old converters are no longer valid,
+	// so start over with a new registry.
+	r := &converterRegistry{funcs: map[reflect.Type]reflect.Value{}}
+	if old := d.cfg.convs; old != nil {
+		maps.Copy(r.funcs, old.funcs)
+	}
+	if _, ok := r.funcs[t]; ok {
+		panic(fmt.Sprintf("gdl.RegisterConverter: converter for %s already registered", t))
+	}
+	r.funcs[t] = fv
+	d.cfg.convs = r
+}
+
+// A converterRegistry holds the converters of a Decoder, and the
+// programs compiled with them.
+type converterRegistry struct {
+	funcs map[reflect.Type]reflect.Value // type to func(string) (type, error)
+	progs sync.Map                       // progKey to *program
+}
+
+// setFunc returns a function that sets a value of type t by calling
+// the converter for t, or nil if there is none. r may be nil.
+func (r *converterRegistry) setFunc(t reflect.Type) func(reflect.Value, string) error {
+	if r == nil {
+		return nil
+	}
+	f, ok := r.funcs[t]
+	if !ok {
+		return nil
+	}
+	return func(rv reflect.Value, s string) error {
+		out := f.Call([]reflect.Value{reflect.ValueOf(s)})
+		if err, _ := out[1].Interface().(error); err != nil {
+			return err
+		}
+		rv.Set(out[0])
+		return nil
+	}
+}
@@ -0,0 +1,332 @@
+// Copyright 2024 by Jonathan Amsterdam.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package gdl
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type Shape interface{ area() float64 }
+
+type Circle struct{ Radius float64 }
+
+func (c Circle) area() float64 { return 3 * c.Radius * c.Radius }
+
+type Rect struct{ Width, Height float64 }
+
+func (r *Rect) area() float64 { return r.Width * r.Height }
+
+type drawing struct {
+	Name       string
+	Shapes     []Shape
+	Background Shape
+}
+
+func shapeDecoder(in string) *Decoder {
+	d := NewDecoder(strings.NewReader(in))
+	RegisterType[Shape](d, "circle", Circle{})
+	RegisterType[Shape](d, "rect", &Rect{})
+	return d
+}
+
+func TestRegisterType(t *testing.T) {
+	const in = `name d
+shape (
+	circle 1
+	rect 2 3
+	circle 4
+)
+background (
+	rect width 5
+	rect height 6
+)
+`
+	var got drawing
+	if err := shapeDecoder(in).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	want := drawing{
+		Name:       "d",
+		Shapes:     []Shape{Circle{1}, &Rect{2, 3}, Circle{4}},
+		Background: &Rect{5, 6},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	// Round trip.
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	RegisterType[Shape](e, "circle", Circle{})
+	RegisterType[Shape](e, "rect", &Rect{})
+	if err := e.Encode(got); err != nil {
+		t.Fatal(err)
+	}
+	var got2 drawing
+	if err := shapeDecoder(buf.String()).Decode(&got2); err != nil {
+		t.Fatalf("%s: %v", buf.Bytes(), err)
+	}
+	if !reflect.DeepEqual(got2, want) {
+		t.Errorf("round trip of %q: got %+v, want %+v", buf.Bytes(), got2, want)
+	}
+}
+
+func TestRegisterTypeError(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want string
+	}{
+		{"shape square 1", `<no file>:1:7: cannot unmarshal "square" into field Shapes of type gdl.Shape: unknown keyword: no type registered as "square"`},
+		{"shape circle x", `<no file>:1:14: *field Shapes.Radius of type float64*`},
+		{"shape", "<no file>:1:1: *missing type name"},
+		{"background (circle radius 1; rect width 2)", "<no file>:1:30: *type differs from gdl.Circle"},
+		{"background rect width 1\nbackground rect height 2", "<no file>:2:1: *keyword repeated; first occurrence at <no file>:1:1"},
+	} {
+		matchError(t, tc.in, shapeDecoder(tc.in).Decode(&drawing{}), tc.want)
+	}
+
+	// Without registered types, no name is known.
+	d := NewDecoder(strings.NewReader("shape circle 1"))
+	matchError(t, "unregistered", d.Decode(&drawing{}), `*no type registered as "circle"`)
+
+	// Marshaling an unregistered type fails.
+	if _, err := Marshal(drawing{Shapes: []Shape{Circle{1}}}); err == nil {
+		t.Error("Marshal of unregistered type: got nil, want error")
+	}
+}
+
+func TestRegisterTypePanic(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		f    func(*Decoder)
+	}{
+		{"not interface", func(d *Decoder) { RegisterType[Circle](d, "c", Circle{}) }},
+		{"nil", func(d *Decoder) { RegisterType[Shape](d, "c", nil) }},
+		{"not struct", func(d *Decoder) { RegisterType[any](d, "i", 1) }},
+		{"dup name", func(d *Decoder) { RegisterType[Shape](d, "circle", &Rect{}) }},
+		{"dup type", func(d *Decoder) { RegisterType[Shape](d, "round", Circle{}) }},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: did not panic", tc.name)
+				}
+			}()
+			tc.f(shapeDecoder(""))
+		}()
+	}
+}
+
+type Step interface{ isStep() }
+
+type Copy struct{ Src, Dst string }
+type Run struct{ Args []string }
+type Env struct {
+	Name string `gdl:",id"`
+	Val  string
+}
+
+func (Copy) isStep() {}
+func (Run) isStep()  {}
+func (*Env) isStep() {}
+
+type build struct {
+	Image string
+	Steps []Step `gdl:",statements"`
+}
+
+type stage struct {
+	Name  string `gdl:",id"`
+	Steps []Step `gdl:",statements"`
+}
+
+func registerSteps(r Registry) {
+	RegisterType[Step](r, "copy", Copy{})
+	RegisterType[Step](r, "run", Run{})
+	RegisterType[Step](r, "env", &Env{})
+}
+
+func TestStatements(t *testing.T) {
+	const in = `image golang
+copy src /app
+run go build ./...
+env (
+	CGO_ENABLED 0
+	GOOS linux
+)
+run go test ./...
+`
+	d := NewDecoder(strings.NewReader(in))
+	registerSteps(d)
+	var got build
+	if err := d.Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	want := build{
+		Image: "golang",
+		Steps: []Step{
+			Copy{"src", "/app"},
+			Run{[]string{"go", "build", "./..."}},
+			&Env{"CGO_ENABLED", "0"},
+			&Env{"GOOS", "linux"},
+			Run{[]string{"go", "test", "./..."}},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	// Round trip.
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	registerSteps(e)
+	if err := e.Encode(got); err != nil {
+		t.Fatal(err)
+	}
+	d = NewDecoder(&buf)
+	registerSteps(d)
+	var got2 build
+	if err := d.Decode(&got2); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got2, want) {
+		t.Errorf("round trip: got %+v, want %+v", got2, want)
+	}
+
+	// Statements in the elements of a slice of structs.
+	d = NewDecoder(strings.NewReader("stage build (\n\tcopy a b\n\trun make\n)\nstage test run make test\n"))
+	registerSteps(d)
+	var stages struct{ Stages []stage }
+	if err := d.Decode(&stages); err != nil {
+		t.Fatal(err)
+	}
+	wantStages := []stage{
+		{"build", []Step{Copy{"a", "b"}, Run{[]string{"make"}}}},
+		{"test", []Step{Run{[]string{"make", "test"}}}},
+	}
+	if !reflect.DeepEqual(stages.Stages, wantStages) {
+		t.Errorf("got %+v, want %+v", stages.Stages, wantStages)
+	}
+}
+
+func TestStatementsError(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want string
+	}{
+		{"copy a b c", `<no file>:1:10: cannot unmarshal "c" into field Steps of type gdl.Copy: unknown keyword`},
+		{"env", `<no file>:1:1: cannot unmarshal "env" into field Steps of type *gdl.Env: no words for struct with ID`},
+	} {
+		d := NewDecoder(strings.NewReader(tc.in))
+		registerSteps(d)
+		matchError(t, tc.in, d.Decode(&build{}), tc.want)
+	}
+
+	for _, p := range []any{
+		&struct {
+			Steps []Copy `gdl:",statements"`
+		}{},
+		&struct {
+			A []Step `gdl:",statements"`
+			B []Step `gdl:",statements"`
+		}{},
+	} {
+		if err := UnmarshalValues([]Value{{Words: []string{"x"}}}, p); err == nil {
+			t.Errorf("%T: got nil, want error", p)
+		}
+	}
+}
+
+type color uint32
+
+func parseColor(s string) (color, error) {
+	h, ok := strings.CutPrefix(s, "#")
+	if !ok {
+		return 0, fmt.Errorf("color %q does not begin with '#'", s)
+	}
+	c, err := strconv.ParseUint(h, 16, 32)
+	return color(c), err
+}
+
+type palette struct {
+	Name       string
+	Background *color
+	Colors     []color
+	Named      map[string]color
+}
+
+func TestRegisterConverter(t *testing.T) {
+	const in = "name p\nbackground #ffffff\ncolors #ff0000 #00ff00\nnamed red #ff0000\n"
+	d := NewDecoder(strings.NewReader(in))
+	d.RegisterConverter(parseColor)
+	var got palette
+	if err := d.Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	white := color(0xffffff)
+	want := palette{
+		Name:       "p",
+		Background: &white,
+		Colors:     []color{0xff0000, 0x00ff00},
+		Named:      map[string]color{"red": 0xff0000},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	d = NewDecoder(strings.NewReader("colors #ff0000 red"))
+	d.RegisterConverter(parseColor)
+	matchError(t, "bad color", d.Decode(&palette{}), `<no file>:1:16: cannot unmarshal "red" into field Colors of type gdl.color: color "red" does not begin with '#'`)
+
+	// Converters affect only the Decoder they are registered with.
+	d = NewDecoder(strings.NewReader("colors 255"))
+	got = palette{}
+	if err := d.Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if want := []color{255}; !reflect.DeepEqual(got.Colors, want) {
+		t.Errorf("without converter: got %v, want %v", got.Colors, want)
+	}
+
+	// A converter takes precedence over UnmarshalText.
+	d = NewDecoder(strings.NewReader("d loud"))
+	d.RegisterConverter(func(s string) (level, error) { return warn, nil })
+	var dep dependency
+	if err := d.Decode(&dep); err != nil {
+		t.Fatal(err)
+	}
+	if dep.Level != warn {
+		t.Errorf("got level %d, want %d", dep.Level, warn)
+	}
+}
+
+func TestRegisterConverterPanic(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		f    any
+	}{
+		{"nil", nil},
+		{"not func", 1},
+		{"no error", func(string) color { return 0 }},
+		{"not string", func(int) (color, error) { return 0, nil }},
+		{"dup", parseColor},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: did not panic", tc.name)
+				}
+			}()
+			d := NewDecoder(strings.NewReader(""))
+			d.RegisterConverter(parseColor)
+			d.RegisterConverter(tc.f)
+		}()
+	}
+}
@@ -0,0 +1,379 @@
+// Copyright 2024 by Jonathan Amsterdam.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package gdl
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	durationType = reflect.TypeFor[time.Duration]()
+	timeType     = reflect.TypeFor[time.Time]()
+	urlType      = reflect.TypeFor[url.URL]()
+)
+
+// parseInt parses s as a Go integer literal, with an optional sign,
+// or as a rune literal, for an integer type of the given size.
+func parseInt(s string, bits int) (int64, error) {
+	if r, ok, err := parseRune(s, "ParseInt"); ok {
+		if err == nil && bits < 32 && int64(r) >= 1<<(bits-1) {
+			err = &strconv.NumError{Func: "ParseInt", Num: s, Err: strconv.ErrRange}
+		}
+		return int64(r), err
+	}
+	return strconv.ParseInt(s, 0, bits)
+}
+
+// parseUint is like parseInt, for an unsigned integer type.
+func parseUint(s string, bits int) (uint64, error) {
+	if r, ok, err := parseRune(s, "ParseUint"); ok {
+		if err == nil && bits < 32 && uint64(r) >= 1<<bits {
+			err = &strconv.NumError{Func: "ParseUint", Num: s, Err: strconv.ErrRange}
+		}
+		return uint64(r), err
+	}
+	return strconv.ParseUint(s, 0, bits)
+}
+
+// parseRune parses s as a rune literal, like 'a' or '\n'. It reports
+// whether s looks like one; if so, err is non-nil if it is malformed.
+// fn is the name of the function for the error.
+func parseRune(s, fn string) (r rune, ok bool, err error) {
+	if !strings.HasPrefix(s, "'") {
+		return 0, false, nil
+	}
+	if len(s) >= 3 && s[len(s)-1] == '\'' {
+		r, _, tail, err := strconv.UnquoteChar(s[1:len(s)-1], '\'')
+		if err == nil && tail == "" {
+			return r, true, nil
+		}
+	}
+	return 0, true, &strconv.NumError{Func: fn, Num: s, Err: strconv.ErrSyntax}
+}
+
+// parseFloat parses s as a Go floating-point or integer literal,
+// with an optional sign. Unlike [strconv.ParseFloat], it does not
+// accept words like "Inf" and "NaN", which are not Go literals.
+func parseFloat(s string, bits int) (float64, error) {
+	if !isNumber(s) {
+		return 0, &strconv.NumError{Func: "ParseFloat", Num: s, Err: strconv.ErrSyntax}
+	}
+	return strconv.ParseFloat(s, bits)
+}
+
+// parseComplex parses s as a Go complex literal, like "1+2i" or "(1-2i)".
+// Like parseFloat, it does not accept "Inf" or "NaN" in either part.
+func parseComplex(s string, bits int) (complex128, error) {
+	// Both words contain an "n", which no Go number literal does.
+	if strings.ContainsAny(s, "nN") {
+		return 0, &strconv.NumError{Func: "ParseComplex", Num: s, Err: strconv.ErrSyntax}
+	}
+	return strconv.ParseComplex(s, bits)
+}
+
+// boolWords are the words that mean true and false when a Decoder
+// allows them; see [Decoder.AllowBoolWords].
+var boolWords = map[string]bool{
+	"yes": true, "no": false,
+	"on": true, "off": false,
+}
+
+// parseBool parses s as a bool. Only "true" and "false" are bools,
+// and, if words is true, the words in boolWords.
+func parseBool(s string, words bool) (bool, error) {
+	switch s {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	if b, ok := boolWords[s]; ok && words {
+		return b, nil
+	}
+	return false, &strconv.NumError{Func: "ParseBool", Num: s, Err: strconv.ErrSyntax}
+}
+
+// isBytes reports whether t is a slice of bytes.
+func isBytes(t reflect.Type) bool {
+	return t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8
+}
+
+// decodeBytes decodes a word holding bytes. A word beginning with "base64:"
+// or "hex:" is decoded accordingly; other words are in base64, or in hex
+// if isHex is true.
+func decodeBytes(s string, isHex bool) ([]byte, error) {
+	if b, ok := strings.CutPrefix(s, "base64:"); ok {
+		return base64.StdEncoding.DecodeString(b)
+	}
+	if h, ok := strings.CutPrefix(s, "hex:"); ok {
+		return hex.DecodeString(h)
+	}
+	if isHex {
+		return hex.DecodeString(s)
+	}
+	return base64.StdEncoding.DecodeString(s)
+}
+
+// encodeBytes encodes b as a word, in base64 or hex, with a prefix
+// that says which.
+func encodeBytes(b []byte, isHex bool) string {
+	if isHex {
+		return "hex:" + hex.EncodeToString(b)
+	}
+	return "base64:" + base64.StdEncoding.EncodeToString(b)
+}
+
+// A ByteSize is a number of bytes. It is written as an integer with an optional
+// unit, either decimal (KB, MB, GB, TB, PB, EB) or binary (KiB, MiB, GiB, TiB,
+// PiB, EiB), as in "64MiB" or "1.5GB". Units are matched regardless of case,
+// and "B" means bytes.
+//
+// An integer field tagged with the "size" option, as in `gdl:",size"`,
+// is read and written the same way.
+type ByteSize int64
+
+// UnmarshalText implements [encoding.TextUnmarshaler].
+func (s *ByteSize) UnmarshalText(b []byte) error {
+	n, err := parseSize(string(b))
+	if err != nil {
+		return err
+	}
+	*s = ByteSize(n)
+	return nil
+}
+
+// MarshalText implements [encoding.TextMarshaler].
+func (s ByteSize) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// String returns s in the largest unit that holds it exactly.
+func (s ByteSize) String() string {
+	return formatSize(int64(s))
+}
+
+// sizeUnits are the units of a ByteSize, largest first.
+var sizeUnits = []struct {
+	name string
+	n    int64
+}{
+	{"EiB", 1 << 60}, {"EB", 1e18},
+	{"PiB", 1 << 50}, {"PB", 1e15},
+	{"TiB", 1 << 40}, {"TB", 1e12},
+	{"GiB", 1 << 30}, {"GB", 1e9},
+	{"MiB", 1 << 20}, {"MB", 1e6},
+	{"KiB", 1 << 10}, {"KB", 1e3},
+}
+
+// parseSize parses a byte size, as described at [ByteSize].
+func parseSize(s string) (int64, error) {
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return !strings.ContainsRune("0123456789+-.", r)
+	})
+	num, unit := s, ""
+	if i >= 0 {
+		num, unit = s[:i], s[i:]
+	}
+	mult := int64(1)
+	if !strings.EqualFold(unit, "B") && unit != "" {
+		mult = 0
+		for _, u := range sizeUnits {
+			if strings.EqualFold(unit, u.name) {
+				mult = u.n
+				break
+			}
+		}
+		if mult == 0 {
+			return 0, fmt.Errorf("bad byte size %q: unknown unit %q", s, unit)
+		}
+	}
+	if !strings.Contains(num, ".") {
+		n, err := strconv.ParseInt(num, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("bad byte size %q: %w", s, errors.Unwrap(err))
+		}
+		if n > math.MaxInt64/mult || n < math.MinInt64/mult {
+			return 0, fmt.Errorf("byte size %q out of range", s)
+		}
+		return n * mult, nil
+	}
+	f, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0, fmt.Errorf("bad byte size %q: %w", s, errors.Unwrap(err))
+	}
+	f *= float64(mult)
+	if f != math.Trunc(f) {
+		return 0, fmt.Errorf("byte size %q is not a whole number of bytes", s)
+	}
+	if f >= math.MaxInt64 || f < math.MinInt64 {
+		return 0, fmt.Errorf("byte size %q out of range", s)
+	}
+	return int64(f), nil
+}
+
+// formatSize formats n in the largest unit that holds it exactly.
+func formatSize(n int64) string {
+	if n != 0 {
+		for _, u := range sizeUnits {
+			if n%u.n == 0 {
+				return strconv.FormatInt(n/u.n, 10) + u.name
+			}
+		}
+	}
+	return strconv.FormatInt(n, 10)
+}
+
+// timeLayouts are the names of the layouts in package time
+// that can be used in the "layout" tag option.
+var timeLayouts = map[string]string{
+	"Layout":      time.Layout,
+	"ANSIC":       time.ANSIC,
+	"UnixDate":    time.UnixDate,
+	"RubyDate":    time.RubyDate,
+	"RFC822":      time.RFC822,
+	"RFC822Z":     time.RFC822Z,
+	"RFC850":      time.RFC850,
+	"RFC1123":     time.RFC1123,
+	"RFC1123Z":    time.RFC1123Z,
+	"RFC3339":     time.RFC3339,
+	"RFC3339Nano": time.RFC3339Nano,
+	"Kitchen":     time.Kitchen,
+	"Stamp":       time.Stamp,
+	"StampMilli":  time.StampMilli,
+	"StampMicro":  time.StampMicro,
+	"StampNano":   time.StampNano,
+	"DateTime":    time.DateTime,
+	"DateOnly":    time.DateOnly,
+	"TimeOnly":    time.TimeOnly,
+}
+
+// scalarOpts are the options in a field's tag that affect how its scalar
+// values, or the elements of its slice or array, are read and written.
+type scalarOpts struct {
+	layouts []string // time layouts, from "layout=..." options; the first is for writing
+	hex     bool     // []byte in hex, from the "hex" option
+	size    bool     // integers as byte sizes, from the "size" option
+}
+
+// fieldScalarOpts returns the scalar options of sf.
+func fieldScalarOpts(sf reflect.StructField) scalarOpts {
+	var o scalarOpts
+	_, opts, _ := strings.Cut(sf.Tag.Get("gdl"), ",")
+	for _, opt := range strings.Split(opts, ",") {
+		opt = strings.TrimSpace(opt)
+		switch {
+		case opt == "hex":
+			o.hex = true
+		case opt == "size":
+			o.size = true
+		case strings.HasPrefix(opt, "layout="):
+			l := strings.TrimPrefix(opt, "layout=")
+			if named, ok := timeLayouts[l]; ok {
+				l = named
+			}
+			o.layouts = append(o.layouts, l)
+		}
+	}
+	return o
+}
+
+// setFunc is like [setScalarFunc], but it applies the options
+// to the types they affect.
+func (o scalarOpts) setFunc(t reflect.Type, cfg config) func(reflect.Value, string) error {
+	if f := cfg.convs.setFunc(t); f != nil {
+		return f
+	}
+	base := t
+	if base.Kind() == reflect.Pointer {
+		base = base.Elem()
+	}
+	var f func(reflect.Value, string) error
+	switch {
+	case len(o.layouts) > 0 && base == timeType:
+		f = func(rv reflect.Value, s string) error {
+			var firstErr error
+			for _, l := range o.layouts {
+				tm, err := time.Parse(l, s)
+				if err == nil {
+					rv.Set(reflect.ValueOf(tm))
+					return nil
+				}
+				if firstErr == nil {
+					firstErr = err
+				}
+			}
+			return firstErr
+		}
+	case o.hex && isBytes(base):
+		f = func(rv reflect.Value, s string) error {
+			b, err := decodeBytes(s, true)
+			if err != nil {
+				return err
+			}
+			rv.SetBytes(b)
+			return nil
+		}
+	case o.size && base.Kind() >= reflect.Int && base.Kind() <= reflect.Uintptr:
+		f = func(rv reflect.Value, s string) error {
+			n, err := parseSize(s)
+			if err != nil {
+				return err
+			}
+			if rv.CanInt() {
+				if rv.OverflowInt(n) {
+					return fmt.Errorf("byte size %q out of range for %s", s, rv.Type())
+				}
+				rv.SetInt(n)
+				return nil
+			}
+			if n < 0 || rv.OverflowUint(uint64(n)) {
+				return fmt.Errorf("byte size %q out of range for %s", s, rv.Type())
+			}
+			rv.SetUint(uint64(n))
+			return nil
+		}
+	default:
+		return setScalarFunc(t, cfg)
+	}
+	if base != t {
+		return func(rv reflect.Value, s string) error {
+			p := reflect.New(base)
+			if err := f(p.Elem(), s); err != nil {
+				return err
+			}
+			rv.Set(p)
+			return nil
+		}
+	}
+	return f
+}
+
+// format is like [formatScalar], but it applies the options
+// to the types they affect.
+func (o scalarOpts) format(v reflect.Value) (string, error) {
+	if v.Kind() == reflect.Pointer && !v.IsNil() {
+		v = v.Elem()
+	}
+	switch {
+	case len(o.layouts) > 0 && v.Type() == timeType:
+		return v.Interface().(time.Time).Format(o.layouts[0]), nil
+	case o.hex && isBytes(v.Type()):
+		return encodeBytes(v.Bytes(), true), nil
+	case o.size && v.CanInt():
+		return formatSize(v.Int()), nil
+	case o.size && v.CanUint() && v.Uint() <= math.MaxInt64:
+		return formatSize(int64(v.Uint())), nil
+	}
+	return formatScalar(v)
+}
@@ -0,0 +1,244 @@
+// Copyright 2024 by Jonathan Amsterdam.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package gdl
+
+import (
+	"math/big"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+type server struct {
+	Timeout  time.Duration
+	Since    time.Time
+	Day      time.Time `gdl:",layout=DateOnly,layout=2006/01/02"`
+	Max      ByteSize
+	Buffer   int32 `gdl:",size"`
+	Endpoint *url.URL
+	Addr     netip.Addr
+	Listen   netip.AddrPort
+	Subnet   netip.Prefix
+	Match    *regexp.Regexp
+	Big      *big.Int
+	Ratio    *big.Float
+	Key      []byte
+	Digest   []byte `gdl:",hex"`
+	Retries  []time.Duration
+}
+
+func TestScalarTypes(t *testing.T) {
+	const in = `timeout 30s
+since 2024-01-02T03:04:05Z
+day 2024/05/06
+max 64MiB
+buffer 1.5KiB
+endpoint https://example.com/a?b=c
+addr 10.0.0.1
+listen 10.0.0.1:8080
+subnet 10.0.0.0/8
+match ^a+b$
+big 123456789012345678901234567890
+ratio 1.5
+key base64:aGVsbG8=
+digest 00ff
+retries 1s 2m
+`
+	vals, err := Parse(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got server
+	if err := UnmarshalValues(vals, &got); err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse("https://example.com/a?b=c")
+	b, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	want := server{
+		Timeout:  30 * time.Second,
+		Since:    time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Day:      time.Date(2024, 5, 6, 0, 0, 0, 0, time.UTC),
+		Max:      64 << 20,
+		Buffer:   1536,
+		Endpoint: u,
+		Addr:     netip.MustParseAddr("10.0.0.1"),
+		Listen:   netip.MustParseAddrPort("10.0.0.1:8080"),
+		Subnet:   netip.MustParsePrefix("10.0.0.0/8"),
+		Match:    regexp.MustCompile("^a+b$"),
+		Big:      b,
+		Ratio:    new(big.Float).SetPrec(64).SetFloat64(1.5),
+		Key:      []byte("hello"),
+		Digest:   []byte{0, 255},
+		Retries:  []time.Duration{time.Second, 2 * time.Minute},
+	}
+	if g, w := vfmt.Sprint(got), vfmt.Sprint(want); g != w {
+		t.Errorf("got\n%s\nwant\n%s", g, w)
+	}
+
+	// Round trip.
+	type servers struct{ Servers []server }
+	out, err := Marshal(servers{[]server{want}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const wantOut = "server 30s 2024-01-02T03:04:05Z 2024-05-06 64MiB 1536 https://example.com/a?b=c 10.0.0.1 10.0.0.1:8080 10.0.0.0/8 ^a+b$ 123456789012345678901234567890 1.5 base64:aGVsbG8= hex:00ff 1s 2m0s\n"
+	if string(out) != wantOut {
+		t.Errorf("got\n%s\nwant\n%s", out, wantOut)
+	}
+	vals, err = Parse(string(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got2 servers
+	if err := UnmarshalValues(vals, &got2); err != nil {
+		t.Fatal(err)
+	}
+	if g, w := vfmt.Sprint(got2.Servers[0]), vfmt.Sprint(want); g != w {
+		t.Errorf("round trip: got\n%s\nwant\n%s", g, w)
+	}
+}
+
+func TestScalarTypesError(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want string
+	}{
+		{"timeout 30", `*field Timeout of type time.Duration: time: missing unit in duration "30"`},
+		{"day 2024-13-01", `*field Day of type time.Time: parsing time "2024-13-01": month out of range`},
+		{"max 1QB", `*field Max of type gdl.ByteSize: bad byte size "1QB": unknown unit "QB"`},
+		{"max 1.5B", `*not a whole number of bytes`},
+		{"max 16EiB", `*byte size "16EiB" out of range`},
+		{"buffer 2GiB", `*byte size "2GiB" out of range for int32`},
+		{"key hex:0g", `*field Key of type *]uint8: encoding/hex: invalid byte*`},
+		{"endpoint ::", `*field Endpoint of type *url.URL: parse "::": missing protocol scheme`},
+	} {
+		vals, err := Parse(tc.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		matchError(t, tc.in, UnmarshalValues(vals, &server{}), tc.want)
+	}
+}
+
+func TestByteSize(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want ByteSize
+		out  string
+	}{
+		{"0", 0, "0"},
+		{"512", 512, "512"},
+		{"512b", 512, "512"},
+		{"1KB", 1000, "1KB"},
+		{"1kib", 1024, "1KiB"},
+		{"1000KiB", 1024000, "1000KiB"},
+		{"1.5GB", 1500000000, "1500MB"},
+		{"64MiB", 64 << 20, "64MiB"},
+		{"-2MB", -2000000, "-2MB"},
+	} {
+		var got ByteSize
+		if err := got.UnmarshalText([]byte(tc.in)); err != nil {
+			t.Errorf("%q: %v", tc.in, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%q: got %d, want %d", tc.in, got, tc.want)
+		}
+		if s := got.String(); s != tc.out {
+			t.Errorf("%q: String() = %q, want %q", tc.in, s, tc.out)
+		}
+	}
+	if _, err := parseSize(strings.Repeat("9", 30)); err == nil {
+		t.Error("huge size: got nil, want error")
+	}
+}
+
+func TestNumberLiterals(t *testing.T) {
+	type nums struct {
+		I   int
+		I8  int8
+		U16 uint16
+		R   rune
+		F32 float32
+		F   float64
+		C   complex128
+		B   bool
+	}
+	for _, tc := range []struct {
+		in   string
+		want nums
+	}{
+		{"0x1F 0o17 0b11 'a' 1.5 0x1p-2 1+2i true", nums{31, 15, 3, 'a', 1.5, 0.25, 1 + 2i, true}},
+		{"1_000_000 -128 65535 '\\n' -1e3 .5 3i false", nums{1000000, -128, 65535, '\n', -1e3, .5, 3i, false}},
+		{"0755 'x' '\\377' 'é' 0 0 0 false", nums{493, 'x', 255, 'é', 0, 0, 0, false}},
+	} {
+		vals, err := Parse(tc.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got nums
+		if err := UnmarshalValue(vals[0], &got); err != nil {
+			t.Errorf("%s: %v", tc.in, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%s: got %+v, want %+v", tc.in, got, tc.want)
+		}
+	}
+
+	// Round trip of complex numbers.
+	out, err := Marshal(struct{ C complex64 }{1.5 - 2i})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(out), "1.5-2i\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	for _, tc := range []struct {
+		in   string
+		want string
+	}{
+		{"0 300", `field I8 of type int8: strconv.ParseInt: parsing "300": value out of range`},
+		{"0 'é'", `field I8 of type int8: strconv.ParseInt: parsing "'é'": value out of range`},
+		{"0 0 65536", `field U16 of type uint16: strconv.ParseUint: parsing "65536": value out of range`},
+		{"0 0 -1", `field U16 of type uint16*invalid syntax`},
+		{"0 0 0 'ab'", `field R of type int32: strconv.ParseInt: parsing "'ab'": invalid syntax`},
+		{"0 0 0 0 1e39", `field F32 of type float32: strconv.ParseFloat: parsing "1e39": value out of range`},
+		{"0 0 0 0 0 Inf", `field F of type float64: strconv.ParseFloat: parsing "Inf": invalid syntax`},
+		{"0 0 0 0 0 0 x", `field C of type complex128*invalid syntax`},
+		{"0 0 0 0 0 0 NaN", `field C of type complex128: strconv.ParseComplex: parsing "NaN": invalid syntax`},
+		{"0 0 0 0 0 0 1+Infi", `field C of type complex128*invalid syntax`},
+		{"0 0 0 0 0 0 0 t", `field B of type bool: strconv.ParseBool: parsing "t": invalid syntax`},
+		{"0 0 0 0 0 0 0 yes", `field B of type bool: strconv.ParseBool: parsing "yes": invalid syntax`},
+		{"1.5", `field I of type int*invalid syntax`},
+	} {
+		vals, err := Parse(tc.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		matchError(t, tc.in, UnmarshalValue(vals[0], &nums{}), tc.want)
+	}
+}
+
+func TestAllowBoolWords(t *testing.T) {
+	type flags struct{ A, B, C, D, E bool }
+	d := NewDecoder(strings.NewReader("yes off on no true"))
+	d.AllowBoolWords()
+	var got flags
+	if err := d.Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if want := (flags{true, false, true, false, true}); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	d = NewDecoder(strings.NewReader("YES"))
+	d.AllowBoolWords()
+	matchError(t, "YES", d.Decode(&flags{}), `*parsing "YES": invalid syntax`)
+}
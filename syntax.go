@@ -0,0 +1,221 @@
+// Copyright 2024 by Jonathan Amsterdam.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package gdl
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// A Position describes a location in a file.
+type Position struct {
+	Line   int // line number, starting at 1
+	Col    int // byte offset in the line, starting at 1
+	Offset int // byte offset in the file, starting at 0
+}
+
+// IsValid reports whether p is a position in a file.
+// The zero Position is not valid.
+func (p Position) IsValid() bool { return p.Line > 0 }
+
+func (p Position) String() string {
+	if !p.IsValid() {
+		return "-"
+	}
+	return fmt.Sprintf("%d:%d", p.Line, p.Col)
+}
+
+// A File is the syntax tree of a gdl file.
+// Unlike the [Value]s returned by [Parse], it retains the blocks and comments
+// of the file.
+type File struct {
+	Name     string
+	Comments // After holds the comments at the end of the file
+	Stmts    []Stmt
+
+	trailer *nodeSrc // text after the last statement
+}
+
+// A Stmt is a statement in a [File] or [Block]: either a *[Line] or a *[Block].
+type Stmt interface {
+	// Span returns the start and end positions of the statement, not including comments.
+	Span() (start, end Position)
+	// Comment returns the comments attached to the statement.
+	Comment() *Comments
+}
+
+// Comments are the comments attached to a syntax tree node.
+type Comments struct {
+	Before []Comment // whole-line comments before the node
+	Suffix []Comment // comments at the end of the node's line
+	After  []Comment // whole-line comments after the node
+}
+
+// Comment returns c.
+// Embedding Comments in a node type provides this method.
+func (c *Comments) Comment() *Comments { return c }
+
+// A Comment is a single comment.
+type Comment struct {
+	Start Position
+	Token string // the text of the comment, including the initial "//"
+}
+
+// A Word is a single word in a [Line] or a [Block] prefix.
+type Word struct {
+	Start Position
+	Token string // the word as it appears in the file, including any quotation marks
+}
+
+// Value returns the value of the word, after removing quotation marks and
+// interpreting escape sequences.
+func (w Word) Value() string {
+	if w.Quoted() {
+		if s, err := strconv.Unquote(w.Token); err == nil {
+			return s
+		}
+	}
+	return w.Token
+}
+
+// Quoted reports whether the word is a quoted string.
+func (w Word) Quoted() bool {
+	return len(w.Token) > 0 && (w.Token[0] == '"' || w.Token[0] == '`')
+}
+
+// A Line is a statement consisting of a sequence of words.
+type Line struct {
+	Comments
+	Start Position
+	Words []Word
+	End   Position
+
+	src *nodeSrc
+}
+
+// Span implements [Stmt].
+func (l *Line) Span() (start, end Position) { return l.Start, l.End }
+
+// A Block is a parenthesized list of statements, preceded by a possibly empty
+// sequence of words that act as a prefix to each statement in the list.
+//
+// For a Block, Comments.Before holds the comments preceding the block,
+// and the comments in LParen and RParen hold those on the lines of the
+// parentheses.
+type Block struct {
+	Comments
+	Start  Position
+	Prefix []Word
+	LParen LParen
+	Stmts  []Stmt
+	RParen RParen
+
+	open  *nodeSrc // the prefix and open paren
+	close *nodeSrc // the close paren
+	nstmt int      // the number of statements when parsed
+}
+
+// Span implements [Stmt].
+func (b *Block) Span() (start, end Position) {
+	end = b.RParen.Pos
+	end.Col++
+	end.Offset++
+	return b.Start, end
+}
+
+// An LParen is the opening parenthesis of a [Block].
+// Its Suffix holds the comment, if any, that follows it on the same line.
+type LParen struct {
+	Comments
+	Pos Position
+}
+
+// An RParen is the closing parenthesis of a [Block].
+// Its Before holds the comments following the last statement in the block,
+// and its Suffix holds the comment, if any, that follows it on the same line.
+type RParen struct {
+	Comments
+	Pos Position
+}
+
+// Values returns the flattened sequence of values of the file, as returned by [Parse].
+func (f *File) Values() []Value {
+	return appendValues(nil, f.Stmts, nil, f.Name)
+}
+
+func appendValues(vals []Value, stmts []Stmt, prefix []Word, filename string) []Value {
+	for _, s := range stmts {
+		switch s := s.(type) {
+		case *Line:
+			vals = append(vals, lineValue(prefix, s, filename))
+		case *Block:
+			vals = appendValues(vals, s.Stmts, append(prefix[:len(prefix):len(prefix)], s.Prefix...), filename)
+		}
+	}
+	return vals
+}
+
+// lineValue returns the Value for l, the words of which follow prefix.
+func lineValue(prefix []Word, l *Line, filename string) Value {
+	ws := append(prefix[:len(prefix):len(prefix)], l.Words...)
+	v := Value{
+		Words:   wordValues(ws),
+		File:    filename,
+		Line:    l.Start.Line,
+		Start:   l.Start,
+		End:     l.End,
+		WordPos: make([]Position, len(ws)),
+	}
+	for i, w := range ws {
+		v.WordPos[i] = w.Start
+		if w.Quoted() && v.Tokens == nil {
+			v.Tokens = wordTokens(ws)
+		}
+	}
+	return v
+}
+
+func wordValues(ws []Word) []string {
+	var r []string
+	for _, w := range ws {
+		r = append(r, w.Value())
+	}
+	return r
+}
+
+// nodeSrc is the source text of a node, as it was parsed.
+// It lets a node that hasn't changed be printed exactly as it was read.
+type nodeSrc struct {
+	lead   string   // text before the node: blank lines, whole-line comments and indentation
+	before []string // the tokens of the whole-line comments when parsed
+	body   string   // text of the node itself, through the end of its line
+	tokens []string // the tokens of the node's words and suffix comments when parsed
+	tail   string   // text of the body after its last token
+}
+
+func commentTokens(cs []Comment) []string {
+	var ts []string
+	for _, c := range cs {
+		ts = append(ts, c.Token)
+	}
+	return ts
+}
+
+func wordTokens(ws []Word) []string {
+	var ts []string
+	for _, w := range ws {
+		ts = append(ts, w.Token)
+	}
+	return ts
+}
+
+func lineTokens(l *Line) []string {
+	return append(wordTokens(l.Words), commentTokens(l.Suffix)...)
+}
+
+func openTokens(b *Block) []string {
+	ts := append(wordTokens(b.Prefix), "(")
+	return append(ts, commentTokens(b.LParen.Suffix)...)
+}
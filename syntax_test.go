@@ -0,0 +1,175 @@
+// Copyright 2024 by Jonathan Amsterdam.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package gdl
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseSyntax(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want string // output of dumpStmts
+	}{
+		{"a b", "line [a b]"},
+		{"a \"b c\" `d`", "line [a \"b c\" `d`]"},
+		{"a; b", "line [a]; line [b]"},
+		{
+			"// c1\n// c2\na b // s\n",
+			"line [a b] before=[// c1 // c2] suffix=[// s]",
+		},
+		{
+			"a\n// end",
+			"line [a]; after=[// end]",
+		},
+		{
+			"x ( // open\n\t// c\n\ty z\n\t// last\n) // close\n",
+			"block [x] lparen=[// open] {line [y z] before=[// c]} rparen before=[// last] suffix=[// close]",
+		},
+		{
+			"h (a; f(c; d))",
+			"block [h] {line [a]; block [f] {line [c]; line [d]}}",
+		},
+		{"()", "block [] {}"},
+		{"x/y //z", "line [x/y] suffix=[//z]"},
+		{"a; // c\nb", "line [a]; line [b] before=[// c]"},
+	} {
+		f, err := ParseSyntax("test", []byte(tc.in))
+		if err != nil {
+			t.Fatalf("%q: %v", tc.in, err)
+		}
+		got := dumpStmts(f.Stmts)
+		if len(f.After) > 0 {
+			got += "; after=" + dumpComments(f.After)
+		}
+		if got != tc.want {
+			t.Errorf("%q:\ngot  %s\nwant %s", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestParseSyntaxPositions(t *testing.T) {
+	in := "a bb\n  c (\n\td \"e\"\n  )\n"
+	f, err := ParseSyntax("test", []byte(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := f.Stmts[0].(*Line)
+	check := func(what string, got, want Position) {
+		t.Helper()
+		if got != want {
+			t.Errorf("%s: got %#v, want %#v", what, got, want)
+		}
+	}
+	check("line start", line.Start, Position{1, 1, 0})
+	check("line end", line.End, Position{1, 5, 4})
+	check("word 1", line.Words[1].Start, Position{1, 3, 2})
+	block := f.Stmts[1].(*Block)
+	start, end := block.Span()
+	check("block start", start, Position{2, 3, 7})
+	check("block end", end, Position{4, 4, 21})
+	check("lparen", block.LParen.Pos, Position{2, 5, 9})
+	inner := block.Stmts[0].(*Line)
+	check("inner start", inner.Start, Position{3, 2, 12})
+	check("inner word", inner.Words[1].Start, Position{3, 4, 14})
+	check("inner end", inner.End, Position{3, 7, 17})
+}
+
+func TestParseSyntaxError(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want string
+	}{
+		{")", "unexpected close paren"},
+		{"}", "unexpected"},
+		{"a {", "unexpected"},
+		{"a (\nb", "EOF"},
+		{"a (\n) x", "close * must be followed"},
+		{`a "\q"`, "syntax"},
+		{"a \\", "backlash at EOF"},
+	} {
+		_, err := ParseSyntax("test", []byte(tc.in))
+		matchError(t, tc.in, err, tc.want)
+	}
+}
+
+func TestSyntaxErrorPosition(t *testing.T) {
+	for _, tc := range []struct {
+		in        string
+		line, col int
+	}{
+		{"a\n  )", 2, 3},
+		{"a\nb \"c", 2, 3},
+		{"a (\nb", 2, 2},
+		{"a (\n) x", 2, 3},
+	} {
+		_, err := ParseSyntax("test", []byte(tc.in))
+		var se *SyntaxError
+		if !errors.As(err, &se) {
+			t.Fatalf("%q: got %v, want SyntaxError", tc.in, err)
+		}
+		if se.File != "test" || se.Line != tc.line || se.Column != tc.col {
+			t.Errorf("%q: got %s:%d:%d, want test:%d:%d", tc.in, se.File, se.Line, se.Column, tc.line, tc.col)
+		}
+	}
+}
+
+func dumpStmts(stmts []Stmt) string {
+	var parts []string
+	for _, s := range stmts {
+		parts = append(parts, dumpStmt(s))
+	}
+	return strings.Join(parts, "; ")
+}
+
+func dumpStmt(s Stmt) string {
+	var b strings.Builder
+	switch s := s.(type) {
+	case *Line:
+		fmt.Fprintf(&b, "line %s", dumpWords(s.Words))
+	case *Block:
+		fmt.Fprintf(&b, "block %s", dumpWords(s.Prefix))
+		if len(s.LParen.Suffix) > 0 {
+			fmt.Fprintf(&b, " lparen=%s", dumpComments(s.LParen.Suffix))
+		}
+		fmt.Fprintf(&b, " {%s}", dumpStmts(s.Stmts))
+		if len(s.RParen.Before) > 0 || len(s.RParen.Suffix) > 0 {
+			b.WriteString(" rparen")
+			if len(s.RParen.Before) > 0 {
+				fmt.Fprintf(&b, " before=%s", dumpComments(s.RParen.Before))
+			}
+			if len(s.RParen.Suffix) > 0 {
+				fmt.Fprintf(&b, " suffix=%s", dumpComments(s.RParen.Suffix))
+			}
+		}
+	}
+	c := s.Comment()
+	if len(c.Before) > 0 {
+		fmt.Fprintf(&b, " before=%s", dumpComments(c.Before))
+	}
+	if len(c.Suffix) > 0 {
+		fmt.Fprintf(&b, " suffix=%s", dumpComments(c.Suffix))
+	}
+	return b.String()
+}
+
+func dumpWords(ws []Word) string {
+	var ts []string
+	for _, w := range ws {
+		ts = append(ts, w.Token)
+	}
+	return "[" + strings.Join(ts, " ") + "]"
+}
+
+func dumpComments(cs []Comment) string {
+	var ts []string
+	for _, c := range cs {
+		ts = append(ts, c.Token)
+	}
+	return "[" + strings.Join(ts, " ") + "]"
+}
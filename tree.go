@@ -0,0 +1,212 @@
+// Copyright 2024 by Jonathan Amsterdam.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package gdl
+
+import (
+	"iter"
+	"reflect"
+	"strconv"
+	"unicode/utf8"
+)
+
+// A Node is a word in the tree formed by a sequence of Values.
+//
+// Each word of a Value is a child of the node for the word before it,
+// and the first word is a child of the root. Values that begin with the
+// same words share the nodes for those words, so the lines
+//
+//	require (
+//	    example.com/a v1.2.3
+//	    example.com/b v0.2.5
+//	)
+//
+// form a single "require" node with two children. The last word of
+// each Value always has a node of its own, so repeated lines are kept.
+type Node struct {
+	Word     string   // the word; empty for the root
+	File     string   // the file of the word's first occurrence
+	Pos      Position // the position of the word's first occurrence, if known
+	Token    string   // the word's first occurrence as written, with any quotation marks
+	Children []*Node  // in order of first occurrence
+}
+
+// Tree returns the root of the tree formed by vals.
+func Tree(vals []Value) *Node {
+	root := &Node{}
+	for _, v := range vals {
+		root.add(v)
+	}
+	return root
+}
+
+// add adds the words of v to the tree rooted at n.
+func (n *Node) add(v Value) {
+	for i, w := range v.Words {
+		var c *Node
+		if i < len(v.Words)-1 {
+			c = n.interior(w)
+		}
+		if c == nil {
+			c = &Node{Word: w, File: v.File, Token: v.token(i)}
+			if i < len(v.WordPos) {
+				c.Pos = v.WordPos[i]
+			}
+			n.Children = append(n.Children, c)
+		}
+		n = c
+	}
+}
+
+// interior returns the child of n for word that has children, or nil.
+func (n *Node) interior(word string) *Node {
+	for _, c := range n.Children {
+		if c.Word == word && len(c.Children) > 0 {
+			return c
+		}
+	}
+	return nil
+}
+
+// Child returns the first child of n with the given word, or nil if there is none.
+func (n *Node) Child(word string) *Node {
+	for _, c := range n.Children {
+		if c.Word == word {
+			return c
+		}
+	}
+	return nil
+}
+
+// Lookup returns the node reached from n by following the children
+// with the given words, or nil if there is none.
+func (n *Node) Lookup(words ...string) *Node {
+	for _, w := range words {
+		if n = n.Child(w); n == nil {
+			return nil
+		}
+	}
+	return n
+}
+
+// All returns an iterator over the nodes below n, in depth-first order.
+// Each node is yielded with the words of the nodes from n's child to it.
+// The slice of words is reused between iterations.
+func (n *Node) All() iter.Seq2[[]string, *Node] {
+	return func(yield func([]string, *Node) bool) {
+		n.walk(nil, yield)
+	}
+}
+
+func (n *Node) walk(path []string, yield func([]string, *Node) bool) bool {
+	for _, c := range n.Children {
+		p := append(path, c.Word)
+		if !yield(p, c) || !c.walk(p, yield) {
+			return false
+		}
+	}
+	return true
+}
+
+// Value returns the value of the words below n, following the mapping of
+// gdl to JSON: a node whose children have no children of their own is a
+// scalar if it has one child and a []any if it has more. Any other node
+// is a map[string]any from the word of each child to its value; a child
+// with no children has the value nil. A node with no children, like the root
+// of an empty tree, has the value nil.
+//
+// Scalar words are converted as described in the README: "true" and "false"
+// are bools, integers in Go syntax are int64s, floating-point numbers are
+// float64s, and other words are strings. A quoted word is always a string,
+// so "true" and "123" are strings while true and 123 are not.
+func (n *Node) Value() any {
+	if len(n.Children) == 0 {
+		return nil
+	}
+	leaves := true
+	for _, c := range n.Children {
+		if len(c.Children) > 0 {
+			leaves = false
+			break
+		}
+	}
+	if leaves {
+		if len(n.Children) == 1 {
+			return n.Children[0].scalar()
+		}
+		list := make([]any, len(n.Children))
+		for i, c := range n.Children {
+			list[i] = c.scalar()
+		}
+		return list
+	}
+	m := map[string]any{}
+	for _, c := range n.Children {
+		v := c.Value()
+		// A word on a line of its own doesn't replace the same word with children.
+		if _, ok := m[c.Word]; ok && v == nil {
+			continue
+		}
+		m[c.Word] = v
+	}
+	return m
+}
+
+// scalar returns the value of n's word as a scalar.
+func (n *Node) scalar() any {
+	return scalarValue(n.Word, Word{Token: n.Token}.Quoted())
+}
+
+// scalarValue returns the value of the word w as a scalar.
+// A quoted word is always a string.
+func scalarValue(w string, quoted bool) any {
+	if quoted {
+		return w
+	}
+	return wordValue(w)
+}
+
+// wordValue returns the bool, int64, float64 or string represented by w.
+func wordValue(w string) any {
+	switch w {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	if i, err := strconv.ParseInt(w, 0, 64); err == nil {
+		return i
+	}
+	if isNumber(w) {
+		if f, err := strconv.ParseFloat(w, 64); err == nil {
+			return f
+		}
+	}
+	return w
+}
+
+// isNumber reports whether w begins like a number, with a digit
+// or a decimal point after an optional sign.
+// It excludes words like "Inf" and "NaN" that strconv.ParseFloat accepts.
+func isNumber(w string) bool {
+	if len(w) > 0 && (w[0] == '+' || w[0] == '-') {
+		w = w[1:]
+	}
+	r, _ := utf8.DecodeRuneInString(w)
+	return r == '.' || ('0' <= r && r <= '9')
+}
+
+// isAny reports whether t is the type of an empty interface.
+func isAny(t reflect.Type) bool {
+	return t.Kind() == reflect.Interface && t.NumMethod() == 0
+}
+
+// setAny sets rv, of an empty interface type, to the value of n.
+func setAny(rv reflect.Value, n *Node) {
+	if v := n.Value(); v != nil {
+		rv.Set(reflect.ValueOf(v))
+	} else {
+		rv.SetZero()
+	}
+}
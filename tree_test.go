@@ -0,0 +1,166 @@
+// Copyright 2024 by Jonathan Amsterdam.
+// Use of this source code is governed by a license
+// that can be found in the LICENSE file.
+
+package gdl
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUnmarshalAny(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want any
+	}{
+		{"", nil},
+		{"x", "x"},
+		{"a 1\nb 2", map[string]any{"a": int64(1), "b": int64(2)}},
+		{"(\n1\n2\n3\n)", []any{int64(1), int64(2), int64(3)}},
+		{"a 1; a 1", map[string]any{"a": []any{int64(1), int64(1)}}},
+		{
+			"module m\ngo 1.23\nrequire (\n\tm1 v1\n\tm2 v2\n)\n",
+			map[string]any{
+				"module":  "m",
+				"go":      1.23,
+				"require": map[string]any{"m1": "v1", "m2": "v2"},
+			},
+		},
+		{"a true; b false; c True; d 0x1f; e -1.5e3; f Inf; g 1.2.3", map[string]any{
+			"a": true, "b": false, "c": "True", "d": int64(31), "e": -1500.0, "f": "Inf", "g": "1.2.3",
+		}},
+		{"logging; server port 1", map[string]any{"logging": nil, "server": map[string]any{"port": int64(1)}}},
+		{"a; a b c", map[string]any{"a": map[string]any{"b": "c"}}},
+		{"a \"true\"; b \"123\"; c (\"1\"; 2; `3.5`)", map[string]any{
+			"a": "true", "b": "123", "c": []any{"1", int64(2), "3.5"},
+		}},
+	} {
+		vals, err := Parse(tc.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got any
+		if err := UnmarshalValues(vals, &got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%q: got %#v, want %#v", tc.in, got, tc.want)
+		}
+
+		// The Decoder produces the same value.
+		var got2 any = "not nil"
+		if err := NewDecoder(strings.NewReader(tc.in)).Decode(&got2); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got2, tc.want) {
+			t.Errorf("%q: Decoder: got %#v, want %#v", tc.in, got2, tc.want)
+		}
+
+		// Marshaling the tree and reading it back produces the same value.
+		data, err := Marshal(Tree(vals))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got3 any
+		if err := NewDecoder(strings.NewReader(string(data))).Decode(&got3); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got3, tc.want) {
+			t.Errorf("%q: marshaled as %q: got %#v, want %#v", tc.in, data, got3, tc.want)
+		}
+	}
+}
+
+func TestUnmarshalAnyFields(t *testing.T) {
+	type config struct {
+		Name   string
+		Extra  any
+		Tags   []any
+		Labels map[string]any
+	}
+	vals, err := Parse(`name n
+extra a 1
+extra b "2"
+tags 1 "2" true
+tag c
+label k1 1
+label k2 (v1; v2)
+label k3 "true"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got config
+	if err := UnmarshalValues(vals, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := config{
+		Name:   "n",
+		Extra:  map[string]any{"a": int64(1), "b": "2"},
+		Tags:   []any{int64(1), "2", true, "c"},
+		Labels: map[string]any{"k1": int64(1), "k2": []any{"v1", "v2"}, "k3": "true"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v, want %#v", got, want)
+	}
+
+	// Top-level maps and slices.
+	vals, err = Parse("a 1\nb \"x\"\nb y\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]any
+	if err := UnmarshalValues(vals, &m); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]any{"a": int64(1), "b": []any{"x", "y"}}; !reflect.DeepEqual(m, want) {
+		t.Errorf("map: got %#v, want %#v", m, want)
+	}
+	var s []any
+	if err := UnmarshalValues(vals, &s); err != nil {
+		t.Fatal(err)
+	}
+	if want := []any{"a", int64(1), "b", "x", "b", "y"}; !reflect.DeepEqual(s, want) {
+		t.Errorf("slice: got %#v, want %#v", s, want)
+	}
+
+	// Such values can't be marshaled.
+	if _, err := Marshal(got); err == nil {
+		t.Error("Marshal: got nil, want error")
+	}
+}
+
+func TestTree(t *testing.T) {
+	f, err := ParseSyntax("test", []byte("require (\n\tm1 v1\n\tm2 v2\n)\ngo 1.23\nrequire m3 v3\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := Tree(f.Values())
+
+	var got []string
+	for path, n := range root.All() {
+		got = append(got, strings.Join(path, ".")+"@"+n.Pos.String())
+	}
+	want := []string{
+		"require@1:1",
+		"require.m1@2:2", "require.m1.v1@2:5",
+		"require.m2@3:2", "require.m2.v2@3:5",
+		"require.m3@6:9", "require.m3.v3@6:12",
+		"go@5:1", "go.1.23@5:4",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %v\nwant %v", got, want)
+	}
+
+	if n := root.Lookup("require", "m2", "v2"); n == nil || n.File != "test" || len(n.Children) != 0 {
+		t.Errorf("Lookup: got %+v", n)
+	}
+	if n := root.Lookup("require", "m4"); n != nil {
+		t.Errorf("Lookup of missing path: got %+v, want nil", n)
+	}
+	if got := root.Child("go").Value(); got != 1.23 {
+		t.Errorf("go: got %#v, want 1.23", got)
+	}
+}
@@ -5,33 +5,118 @@
 package gdl
 
 import (
+	"encoding"
 	"errors"
 	"fmt"
+	"math"
+	"net/url"
 	"reflect"
-	"strconv"
 	"strings"
 	"sync"
+	"time"
 	"unicode"
-	"unicode/utf8"
 )
 
-// UnmarshalValues unmarshals a list of Values into a pointer to a struct.
-// The struct's fields should all be slices of struct type.
-// The first word of each Value selects the field; see [UnmarshalValue] for
-// details.
+// UnmarshalValues unmarshals a list of Values into a pointer to a struct, map or any.
+// The first word of each Value selects the field, as described for
+// slices of structs in [UnmarshalValue].
 //
-// TODO: a field can also be a single struct or scalar, or a slice of scalars.
-// Scalar: Value must have just two words, "fieldname value".
-// Single: second occurrence is an error.
+// Scalar fields and slices of scalars can also be selected by keyword,
+// using the same matching rules. A scalar field is set from the single word
+// following its keyword, as with
+//
+//	go 1.23
+//
+// for a field named Go. The words after the keyword of a slice of scalars
+// are appended to it. It is an error for the keyword of a scalar field to
+// appear more than once; see [Decoder.AllowRepeatedKeywords] to change that.
+//
+// A field of struct or pointer-to-struct type is also selected by keyword.
+// The words after the keyword are unmarshaled into it as they are at the top level,
+// so the struct is usually written as a block:
+//
+//	server (
+//	    host example.com
+//	    port 8080
+//	)
+//
+// A second occurrence of the keyword is an error unless the struct has an
+// ID field, in which case occurrences with the same ID are merged into one
+// value and occurrences with a different ID are an error.
+// The lines of a single block are all part of one occurrence.
+//
+// A field of map type, whose keys must be strings, is selected by keyword
+// like a slice of structs, and the word after the keyword is the key.
+// A scalar map value is set from the single word after the key; it is an
+// error for the key to appear more than once, as for a scalar keyword.
+// The words after the key are appended to a slice of scalars.
+// A struct value, or a pointer to one, is unmarshaled from the words after
+// the key as for a struct field, and all the Values with the same key add
+// to the same struct. If the struct has an ID field, it is set to the key.
+// For example,
+//
+//	database main user bob
+//
+// sets the entry for "main" in a field named Databases of type map[string]Database.
+// p can also point to a map, whose entries are unmarshaled the same way
+// from every Value, each of which begins with the key.
+//
+// p can also point to a slice or array of structs or pointers to structs.
+// Each Value is unmarshaled by position into a new element, as for a field
+// holding a slice of structs but without the keyword; if the struct has an
+// ID field, Values with the same ID add to the same element. Elements are
+// appended to a slice. An array is filled from the start, and it is an error
+// for there to be more elements than it can hold.
+//
+// A struct field of type [Position] or string tagged `gdl:",pos"` is set to
+// the start of the Value from which the struct was first unmarshaled,
+// so that it can report where it came from. A string holds "file:line:col".
+//
+// Fields of interface type, and slices of them, are selected by keyword too,
+// but unmarshaling them requires a [Decoder] with types registered by [RegisterType].
+// Empty interfaces are the exception. The words after the keyword of a field
+// of type any, in all the Values that select it, form a [Tree], and the field
+// is set to its value, as for a *any below. Likewise, the words after each key
+// of a map with values of type any form a tree for that entry. Each word after
+// the keyword of a []any is an element, a scalar as described at [Node.Value].
+//
+// A slice-of-interface field tagged `gdl:",statements"` collects, in order,
+// every Value whose first word is the name of a type registered for its
+// elements. For example, given
+//
+//	type Build struct {
+//	    Image string
+//	    Steps []Step `gdl:",statements"`
+//	}
+//
+// and types registered for Step as "copy" and "run", the lines
+//
+//	copy src /app
+//	run make
+//
+// append a value of each type to Steps, unmarshaling the words after the
+// name as for an element of a slice of structs. The keywords of other fields
+// take precedence over type names. A struct can have only one statements field.
+//
+// If the first word of a Value is not a keyword, the Value is unmarshaled
+// as with [UnmarshalValue].
+//
+// If p is a *any, it is set to the value of the [Tree] of vals,
+// as described at [Node.Value].
 func UnmarshalValues(vals []Value, p any) (err error) {
 	rv := reflect.ValueOf(p)
-	if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Struct {
-		return fmt.Errorf("gdl.UnmarshalValues: second argument must be pointer to struct, not %T", p)
+	if rv.Kind() == reflect.Pointer && !rv.IsNil() && isAny(rv.Type().Elem()) {
+		setAny(rv.Elem(), Tree(vals))
+		return nil
+	}
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || !isTarget(rv.Type().Elem()) {
+		return fmt.Errorf("gdl.UnmarshalValues: second argument must be pointer to struct, map, slice, array or any, not %T", p)
 	}
 	rv = rv.Elem()
 
+	st := newDecodeState()
 	for _, val := range vals {
-		if err := unmarshalValue(val, rv); err != nil {
+		if err := st.unmarshalValue(val, rv, true); err != nil {
 			return err
 		}
 	}
@@ -41,9 +126,32 @@ func UnmarshalValues(vals []Value, p any) (err error) {
 // UnmarshalValue unmarshals a [Value] v into a pointer to a struct.
 // Each field of the struct should be a scalar type (integer, float, bool or string),
 // A slice of scalars, or a slice of structs.
+// Pointers to any of these are also allowed, as are slices of pointers; they are
+// allocated when they are set.
+//
+// Some other types are scalars too. A [time.Duration] is written as for
+// [time.ParseDuration], as in "30s". A [time.Time] is in RFC 3339 format,
+// or in the layouts given by "layout" options in its tag, as in
+// `gdl:",layout=DateOnly,layout=2006/01/02"`, where a layout can be the name
+// of one of the layout constants of package time. A [url.URL] is parsed by
+// [url.Parse]. A []byte is in base64, or in hex with the "hex" tag option,
+// and a prefix of "base64:" or "hex:" selects the encoding. A [ByteSize],
+// or an integer with the "size" tag option, can have a unit, as in "64MiB".
+//
+// A type that implements [encoding.TextUnmarshaler] is a scalar type:
+// its UnmarshalText method is passed a single word. A type that implements
+// [Unmarshaler] takes a variable number of words. It is placed like a slice of
+// scalars, and its UnmarshalGDL method is passed the words at its positions.
+//
+// The fields of an embedded struct, or of an embedded pointer to a struct,
+// are treated as fields of the outer struct, following the rules of
+// encoding/json for promotion and for fields with the same name.
+// Nil pointers to embedded structs are allocated as needed.
 //
 // The scalar fields are populated with the words of v in order.
 // If the final field is a slice of scalars, it is set to the remaining words.
+// An array of scalars takes as many words as it has elements.
+// A field cannot be an array of any other type.
 // For example, unmarshaling this value:
 //
 //	17 hello big world
@@ -73,78 +181,335 @@ func UnmarshalValues(vals []Value, p any) (err error) {
 //	    Things: {{A: 17, B: "hello", C: []string{"big", "world"}}},
 //	}
 //
-// For slices of structs, the field name is matched with a word as follows:
+// A field's positions can also be given by the name in its tag, counting
+// from 1 at the first word after the keyword or ID:
+//
+//	`gdl:"2"`    the second word, or for an array the words starting there
+//	`gdl:"2-4"`  the second through fourth words, for a slice or array
+//	`gdl:"3-"`   the third word to the end, for a slice
+//	`gdl:"*"`    the words after the previous field to the end, for a slice
+//
+// A field without such a tag takes the position after the previous field's,
+// so positions must increase in field order. Words at positions that
+// no field takes are ignored, so in
+//
+//	type Replace struct {
+//	    From string `gdl:"1"`
+//	    To   string `gdl:"3"`
+//	}
+//
+// the "->" of "replace a -> b" is skipped. A field tagged "-" is ignored.
+// A field that follows one taking the rest of the words, or whose positions
+// come before those of an earlier field, has no positions. It can still be
+// selected by its keyword, but it is an error to unmarshal words into its
+// struct by position.
+//
+// For slices of structs, the field's keyword is matched with a word as follows:
 // The match can be exact, or with the first rune lower-cased, or pluralized.
-// The plural rules are very simple: if the word ends in 's' or 'x', then
-// "es" is appended to it; otherwise "s" is appended.
+// The plural rules follow English: "y" after a consonant becomes "ies",
+// "es" is appended to words ending in "s", "x", "z", "ch" or "sh", and "s"
+// to other words. Irregular plurals like "children" are registered with
+// [RegisterPlural].
 // For example, a field named "Things" will match the following words:
 //
 //	Things
 //	Thing
 //	things
 //	thing
+//
+// A field's keyword is its name with the first letter lower-cased, or
+// the name given in its tag, as in
+//
+//	MaxConn int `gdl:"max-conn"`
+//
+// Alternative keywords follow the name, separated by "|", as in `gdl:"listen|bind"`.
+// [Decoder.SetNaming] selects other ways of deriving keywords from field names,
+// and [Decoder.UseJSONTags] uses the names in json tags.
+//
+// If v cannot be unmarshaled, the error is an [*UnmarshalError].
 func UnmarshalValue(v Value, p any) error {
 	rv := reflect.ValueOf(p)
 	if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Struct {
 		return fmt.Errorf("gdl.UnmarshalValue: second argument must be pointer to struct, not %T", p)
 	}
-	return unmarshalValue(v, rv.Elem())
+	return newDecodeState().unmarshalValue(v, rv.Elem(), false)
+}
+
+// isTarget reports whether t is a type that [UnmarshalValues]
+// unmarshals into directly, other than any.
+func isTarget(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array:
+		return true
+	}
+	return false
+}
+
+// decodeState is the state of unmarshaling a sequence of Values
+// into a single Go value.
+type decodeState struct {
+	val          Value          // the Value being unmarshaled
+	nval         int            // the number of Values unmarshaled, including val
+	path         string         // path of the struct being unmarshaled; see fieldPath
+	seen         map[any]string // field path to position of the keyword that set it
+	allowRepeats bool           // a repeated keyword for a scalar overwrites the value
+	types        *typeRegistry  // concrete types for interface fields; may be nil
+	cfg          config
+
+	// Struct values of map entries, so that later Values with the same
+	// key add to the same value. The values are pointers.
+	entries map[entryKey]reflect.Value
+
+	arrayLens map[string]int // array field path to number of elements added
+
+	occurrences map[string]occurrence // struct field path to the occurrence of the keyword that set it
+
+	// Trees of the Values for fields and map entries of type any,
+	// by field path or entryKey.
+	trees map[any]*Node
+}
+
+// An occurrence identifies an occurrence of a keyword: by the position of
+// the first word of the Value, so that the lines of a block share it,
+// or, if that is unknown, by the Value.
+type occurrence struct {
+	file string
+	pos  Position
+	val  int // the number of the Value, if pos is not valid
+}
+
+// An entryKey identifies a map entry.
+type entryKey struct {
+	m   uintptr // the map's pointer
+	key string
+}
+
+func newDecodeState() *decodeState {
+	return &decodeState{
+		seen:      map[any]string{},
+		entries:   map[entryKey]reflect.Value{},
+		arrayLens: map[string]int{},
+		trees:     map[any]*Node{},
+
+		occurrences: map[string]occurrence{},
+	}
 }
 
-func unmarshalValue(v Value, rv reflect.Value) error {
+// unmarshalValue unmarshals v into rv, which must be a struct, or a map,
+// slice or array to which v adds an entry.
+// If keyed is true, the first word of v is matched as a keyword
+// before it is matched by position.
+func (st *decodeState) unmarshalValue(v Value, rv reflect.Value, keyed bool) error {
 	t := rv.Type()
-	if t.Kind() != reflect.Struct {
-		panic("expected struct")
+	if !isTarget(t) {
+		panic("bad target type")
 	}
-	prog, err := programFor(t)
+	prog, err := programFor(t, st.cfg)
 	if err != nil {
-		return fmt.Errorf("%s:%d: %w", v.File, v.Line, err)
+		return &UnmarshalError{File: v.File, Line: v.Line, Type: t, Err: err}
 	}
-	if err := prog.run(rv, v.Words); err != nil {
-		return fmt.Errorf("%s:%d: %w", v.File, v.Line, err)
+	st.val = v
+	st.nval++
+	if prog.entry != nil {
+		err = prog.entry(st, rv, v.Words)
+	} else if keyed {
+		err = prog.runKeyed(st, rv, v.Words)
+	} else {
+		err = prog.run(st, rv, v.Words)
+	}
+	if err != nil {
+		var ue *UnmarshalError
+		if !errors.As(err, &ue) {
+			ue = &UnmarshalError{Type: t, Err: err}
+		}
+		ue.File = v.File
+		ue.Line = v.Line
+		if ue.rest > 0 {
+			// Since the words passed to programs are always suffixes of the Value's
+			// words, the word is identified by the number of words from it to the end.
+			ue.Line, ue.Column = v.lineCol(len(v.Words) - ue.rest)
+		}
+		return ue
 	}
 	return nil
 }
 
-var programs sync.Map // reflect.Type to *program
+// wordError returns an error for the first of words, which could not be
+// unmarshaled into a value of type t, part of field sf.
+// If there are no words, the error is about the Value as a whole.
+func wordError(sf reflect.StructField, t reflect.Type, words []string, err error) *UnmarshalError {
+	e := &UnmarshalError{Type: t, Field: sf.Name, Err: err, rest: len(words)}
+	if len(words) > 0 {
+		e.Word = words[0]
+	}
+	return e
+}
+
+var programs sync.Map // progKey to *program, for configs without converters
 
-func programFor(t reflect.Type) (*program, error) {
-	if prog, ok := programs.Load(t); ok {
+// programs returns the cache of programs compiled under cfg.
+// Programs that use converters are cached with them, so that they
+// are discarded with the Decoder that registered them.
+func (cfg config) programs() *sync.Map {
+	if cfg.convs != nil {
+		return &cfg.convs.progs
+	}
+	return &programs
+}
+
+// A progKey identifies a program: the same type compiles differently
+// under different configs.
+type progKey struct {
+	t   reflect.Type
+	cfg config
+}
+
+func programFor(t reflect.Type, cfg config) (*program, error) {
+	if prog, ok := cfg.programs().Load(progKey{t, cfg}); ok {
 		return prog.(*program), nil
 	}
-	// We don't need locking, all programs for a type are identical.
-	prog, err := compile(t)
+	c := &compiler{cfg: cfg, progs: map[reflect.Type]*program{}}
+	prog, err := c.program(t)
 	if err != nil {
 		return nil, err
 	}
-	programs.Store(t, prog)
+	// We don't need locking, all programs for a type and config are identical.
+	// Programs are stored only when they are complete.
+	for t, p := range c.progs {
+		cfg.programs().Store(progKey{t, cfg}, p)
+	}
 	return prog, nil
 }
 
+// A compiler compiles the programs for a type and the types it refers to.
+type compiler struct {
+	cfg config
+	// Programs compiled or being compiled. A type that refers to itself,
+	// directly or indirectly, finds its own program here before
+	// the program is complete.
+	progs map[reflect.Type]*program
+}
+
+// program returns the program for t, compiling it if necessary.
+func (c *compiler) program(t reflect.Type) (*program, error) {
+	if prog, ok := c.cfg.programs().Load(progKey{t, c.cfg}); ok {
+		return prog.(*program), nil
+	}
+	if p, ok := c.progs[t]; ok {
+		return p, nil
+	}
+	switch t.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array:
+		p := &program{t: t, cfg: c.cfg}
+		c.progs[t] = p
+		var err error
+		if t.Kind() == reflect.Map {
+			p.entry, err = c.entryFunc(reflect.StructField{}, t)
+		} else {
+			p.entry, _, err = c.elemFunc(reflect.StructField{}, t)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%s is not a struct", t)
+	}
+	p := &program{
+		t:      t,
+		cfg:    c.cfg,
+		ops:    map[any]op{},
+		keyOps: map[any]op{},
+	}
+	// Register p before compiling its fields, so recursive types terminate.
+	c.progs[t] = p
+	if err := c.compile(p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
 // program is a program for setting values of a type from a slice of strings.
 type program struct {
 	t       reflect.Type
+	cfg     config
 	idIndex []int      // index of ID field; group by first word
+	fields  []*field   // fields in struct order, excluding the ID field
 	ops     map[any]op // key is integer index or word
+	keyOps  map[any]op // ops for scalar fields by keyword, used only by runKeyed
+
+	keywordFields map[string]string // keyword to field name, during compilation
+
+	// The statements field, if any, and its op, which takes all the words,
+	// including the type name.
+	stmts   *field
+	stmtsOp op
+
+	posIndexes [][]int // indexes of the pos fields
+	width      int     // positions taken by fields, or math.MaxInt if the last takes the rest
+	conflict   error   // the first layout conflict among the fields; words cannot be matched by position
+
+	entry entryFunc // for a map, slice or array type, adds an entry; no other fields are used
+}
+
+type op func(*decodeState, reflect.Value, []string) ([]string, error)
+
+// A field describes how a single struct field is set from words.
+type field struct {
+	sf       reflect.StructField
+	kind     fieldKind
+	span     span  // positions, for scalar and scalar-slice fields
+	conflict error // the layout conflict that left the field without positions, if any
+	opts     scalarOpts
+	keyword  string   // keyword; for struct-slice fields, the singular form
+	subprog  *program // program for the element type of a struct-slice field
 }
 
-type op func(reflect.Value, []string) ([]string, error)
+type fieldKind int
+
+const (
+	scalarField      fieldKind = iota // matched by position
+	scalarSliceField                  // takes the remaining words
+	structSliceField                  // matched by keyword
+	structField                       // struct or pointer to struct, matched by keyword
+	ifaceSliceField                   // slice of interfaces, matched by keyword and type name
+	ifaceField                        // interface, matched by keyword and type name
+	stmtsField                        // slice of interfaces, matched by type name alone
+	mapField                          // map with string keys, matched by keyword
+	customField                       // Unmarshaler or slice of them, matched like a slice of scalars
+	anyField                          // empty interface or slice of them, matched by keyword
+)
 
 // s is a struct. words is from a Value, positioned just after the first word.
-func (p *program) run(rv reflect.Value, words []string) error {
+// Errors are always of type *UnmarshalError.
+func (p *program) run(st *decodeState, rv reflect.Value, words []string) error {
+	p.setPos(st, rv)
 	var err error
 	ws := words
 	for len(ws) > 0 {
 		i := len(words) - len(ws)
+		if p.conflict != nil && i < p.width {
+			// The word would be matched by position.
+			return &UnmarshalError{Word: ws[0], Type: rv.Type(), Err: p.conflict, rest: len(ws)}
+		}
+		if _, ok := p.ops[i]; !ok && i < p.width {
+			// No field takes the word at this position.
+			ws = ws[1:]
+			continue
+		}
 		op, byIndex := p.findOp(i, ws[0])
+		if op == nil && p.isStatement(st, ws[0]) {
+			_, err := p.stmtsOp(st, rv, ws)
+			return err
+		}
 		if op == nil {
-			return fmt.Errorf("could not set %q at index %d into value of type %s, words=%v",
-				ws[0], i, rv.Type(), words)
+			return &UnmarshalError{Word: ws[0], Type: rv.Type(), Err: ErrUnknownKeyword, rest: len(ws)}
 		}
 		if !byIndex {
 			ws = ws[1:]
 		}
-		ws, err = op(rv, ws)
+		ws, err = op(st, rv, ws)
 		if err != nil {
 			return err
 		}
@@ -152,34 +517,79 @@ func (p *program) run(rv reflect.Value, words []string) error {
 	return nil
 }
 
+// runKeyed is like run, but it first tries to match the first word
+// as a keyword of any field, including scalar fields.
+func (p *program) runKeyed(st *decodeState, rv reflect.Value, words []string) error {
+	p.setPos(st, rv)
+	if len(words) > 0 {
+		op := p.findKeyword(p.keyOps, words[0])
+		if op == nil {
+			op = p.findKeyword(p.ops, words[0])
+		}
+		if op != nil {
+			// Keyword ops consume all the words.
+			_, err := op(st, rv, words[1:])
+			return err
+		}
+		if p.isStatement(st, words[0]) {
+			_, err := p.stmtsOp(st, rv, words)
+			return err
+		}
+	}
+	return p.run(st, rv, words)
+}
+
+// isStatement reports whether w is the name of a type registered
+// for the elements of p's statements field.
+func (p *program) isStatement(st *decodeState, w string) bool {
+	return p.stmts != nil && st.types.lookup(p.stmts.sf.Type.Elem(), w) != nil
+}
+
 // bool is whether it matched on index.
 func (p *program) findOp(i int, w string) (op, bool) {
 	if op, ok := p.ops[i]; ok {
 		return op, true
 	}
-	w = lowerFirst(w)
-	if op, ok := p.ops[w]; ok {
-		return op, false
-	}
-	if op, ok := p.ops[plural(w)]; ok {
-		return op, false
-	}
-	return nil, false
+	return p.findKeyword(p.ops, w), false
 }
 
-// t must be a struct type.
-func compile(t reflect.Type) (*program, error) {
-	if t.Kind() != reflect.Struct {
-		return nil, fmt.Errorf("%s is not a struct", t)
+// findKeyword returns the op in ops that matches w as a keyword, or nil.
+// The word matches a keyword that is the same as it or its plural,
+// after lower-casing its first letter if necessary.
+func (p *program) findKeyword(ops map[any]op, w string) op {
+	w = p.cfg.fold(w)
+	for _, k := range []string{w, lowerFirst(w)} {
+		if op, ok := ops[k]; ok {
+			return op
+		}
+		if op, ok := ops[plural(k)]; ok {
+			return op
+		}
 	}
-	sfs := reflect.VisibleFields(t)
-	p := &program{
-		t:   t,
-		ops: map[any]op{},
+	return nil
+}
+
+// addKeywords adds op, for field sf, to ops under each of kws.
+// It is an error if one of them already selects another field.
+func (p *program) addKeywords(ops map[any]op, sf reflect.StructField, kws []string, op op) error {
+	for _, kw := range kws {
+		kw = p.cfg.fold(kw)
+		if other, ok := p.keywordFields[kw]; ok && other != sf.Name {
+			return fmt.Errorf("keyword %q of field %s is already used by field %s", kw, sf.Name, other)
+		}
+		p.keywordFields[kw] = sf.Name
+		ops[kw] = op
 	}
+	return nil
+}
+
+// compile fills in p, whose type is a struct.
+func (c *compiler) compile(p *program) error {
+	t := p.t
+	sfs := structFields(t)
 	ii, err := idIndex(sfs)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	p.idIndex = ii
 	// The ID field is set outside the program for this type, so, skip it.
@@ -187,101 +597,996 @@ func compile(t reflect.Type) (*program, error) {
 	if ii != nil {
 		sfs = sfs[1:]
 	}
-	for i, sf := range sfs {
-		setf := setScalarFunc(sf.Type)
+	l := layout{t: t}
+	p.keywordFields = map[string]string{}
+	defer func() { p.keywordFields = nil }()
+	for _, sf := range sfs {
+		kws := c.cfg.keywords(sf)
+		opts := fieldScalarOpts(sf)
+		if hasTagOption(sf, "statements") {
+			if err := p.compileStatements(sf); err != nil {
+				return err
+			}
+			continue
+		}
+		if hasTagOption(sf, "pos") {
+			if err := p.compilePos(sf); err != nil {
+				return err
+			}
+			continue
+		}
+		if c.isCustom(sf.Type) {
+			if err := p.compileCustom(sf, &l, kws); err != nil {
+				return err
+			}
+			continue
+		}
+		setf := opts.setFunc(sf.Type, c.cfg)
 		if setf != nil {
-			// sf is of scalar type: it matches by position.
-			op := func(rv reflect.Value, words []string) ([]string, error) {
-				fv, err := rv.FieldByIndexErr(sf.Index)
-				if err != nil {
-					// TODO: create the nil pointers.
+			// sf is of scalar type: it matches by position, or by keyword
+			// at the start of a Value.
+			sp, conflict, err := l.place(sf, 1)
+			if err != nil {
+				return err
+			}
+			op := func(_ *decodeState, rv reflect.Value, words []string) ([]string, error) {
+				fv := fieldByIndex(rv, sf.Index)
+				if err := setf(fv, words[0]); err != nil {
+					return nil, wordError(sf, sf.Type, words, err)
+				}
+				return words[1:], nil
+			}
+			if conflict == nil {
+				p.ops[sp.start] = op
+			}
+			keyOp := func(st *decodeState, rv reflect.Value, words []string) ([]string, error) {
+				if len(words) != 1 {
+					return nil, keywordError(st, sf, words, fmt.Errorf("want one word after keyword, got %d", len(words)))
+				}
+				if err := st.checkRepeat(sf, words); err != nil {
 					return nil, err
 				}
-				return words[1:], setf(fv, words[0])
+				return op(st, rv, words)
+			}
+			if err := p.addKeywords(p.keyOps, sf, kws, keyOp); err != nil {
+				return err
 			}
-			p.ops[i] = op
+			p.fields = append(p.fields, &field{sf: sf, kind: scalarField, span: sp, conflict: conflict, keyword: kws[0], opts: opts})
 		} else {
 			switch sf.Type.Kind() {
+			case reflect.Array:
+				setf := opts.setFunc(sf.Type.Elem(), c.cfg)
+				if setf == nil {
+					return fmt.Errorf("field %s of %s: array element type %s is not a scalar", sf.Name, t, sf.Type.Elem())
+				}
+				// sf is an array of scalars: it takes exactly as many words
+				// as it has elements.
+				sp, conflict, err := l.place(sf, sf.Type.Len())
+				if err != nil {
+					return err
+				}
+				n := sf.Type.Len()
+				op := func(_ *decodeState, rv reflect.Value, words []string) ([]string, error) {
+					if len(words) < n {
+						return nil, wordError(sf, sf.Type, words, fmt.Errorf("want %d words, got %d", n, len(words)))
+					}
+					fv := fieldByIndex(rv, sf.Index)
+					for i, w := range words[:n] {
+						if err := setf(fv.Index(i), w); err != nil {
+							return nil, wordError(sf, sf.Type.Elem(), words[i:], err)
+						}
+					}
+					return words[n:], nil
+				}
+				if conflict == nil {
+					p.ops[sp.start] = op
+				}
+				keyOp := func(st *decodeState, rv reflect.Value, words []string) ([]string, error) {
+					if len(words) != n {
+						return nil, keywordError(st, sf, words, fmt.Errorf("want %d words after keyword, got %d", n, len(words)))
+					}
+					if err := st.checkRepeat(sf, words); err != nil {
+						return nil, err
+					}
+					return op(st, rv, words)
+				}
+				if err := p.addKeywords(p.keyOps, sf, kws, keyOp); err != nil {
+					return err
+				}
+				p.fields = append(p.fields, &field{sf: sf, kind: scalarSliceField, span: sp, conflict: conflict, keyword: kws[0], opts: opts})
+
 			case reflect.Slice:
 				elemType := sf.Type.Elem()
-				setf := setScalarFunc(elemType)
+				setf := opts.setFunc(elemType, c.cfg)
 				if setf != nil {
-					// sf is a slice of scalars: it takes the rest of the words.
-					// TODO: check that there are no fields in this struct that use the word
-					// as as index (that is, fields of non-scalar slice type).
-					if i+1 != len(sfs) {
-						return nil, fmt.Errorf("scalar slice field %s must be last field in struct %s",
-							sf.Name, t)
+					// sf is a slice of scalars: it takes the words in its range,
+					// by default the rest of them.
+					sp, conflict, err := l.place(sf, -1)
+					if err != nil {
+						return err
 					}
-					op := func(rv reflect.Value, words []string) ([]string, error) {
-						fv, err := rv.FieldByIndexErr(sf.Index)
-						if err != nil {
-							// TODO: create the nil pointers.
-							return nil, err
-						}
-						for _, w := range words {
-							fv.Set(reflect.Append(fv, reflect.Zero(fv.Type().Elem())))
-							if err := setf(fv.Index(fv.Len()-1), w); err != nil {
-								return nil, err
+					// The words are appended only if they all convert.
+					appendWords := func(rv reflect.Value, words []string) error {
+						elems := make([]reflect.Value, len(words))
+						for i, w := range words {
+							elems[i] = reflect.New(elemType).Elem()
+							if err := setf(elems[i], w); err != nil {
+								return wordError(sf, elemType, words[i:], err)
 							}
 						}
-						return nil, nil
+						fv := fieldByIndex(rv, sf.Index)
+						fv.Set(reflect.Append(fv, elems...))
+						return nil
+					}
+					op := func(_ *decodeState, rv reflect.Value, words []string) ([]string, error) {
+						n := len(words)
+						if sp.end >= 0 {
+							n = min(n, sp.end-sp.start)
+						}
+						if err := appendWords(rv, words[:n]); err != nil {
+							return nil, err
+						}
+						return words[n:], nil
+					}
+					if conflict == nil {
+						p.ops[sp.start] = op
+					}
+					// By keyword, the words after the keyword are appended.
+					keyOp := func(_ *decodeState, rv reflect.Value, words []string) ([]string, error) {
+						return nil, appendWords(rv, words)
+					}
+					if err := p.addKeywords(p.keyOps, sf, kws, keyOp); err != nil {
+						return err
+					}
+					p.fields = append(p.fields, &field{sf: sf, kind: scalarSliceField, span: sp, conflict: conflict, keyword: kws[0], opts: opts})
+				} else if isAny(elemType) {
+					// A slice of empty interfaces: match on field name.
+					// Each word after it is an element.
+					add, _, err := c.elemFunc(sf, sf.Type)
+					if err != nil {
+						return err
 					}
-					p.ops[i] = op
+					op := func(st *decodeState, rv reflect.Value, words []string) ([]string, error) {
+						return nil, add(st, fieldByIndex(rv, sf.Index), words)
+					}
+					if err := p.addKeywords(p.ops, sf, kws, op); err != nil {
+						return err
+					}
+					p.fields = append(p.fields, &field{sf: sf, kind: anyField, keyword: kws[0]})
+				} else if elemType.Kind() == reflect.Interface {
+					// A slice of interfaces: match on field name, like a slice of structs.
+					// The next word selects the concrete type of the element.
+					op := appendVariantOp(sf)
+					if err := p.addKeywords(p.ops, sf, kws, op); err != nil {
+						return err
+					}
+					p.fields = append(p.fields, &field{sf: sf, kind: ifaceSliceField, keyword: singular(kws[0])})
 				} else {
 					// A slice of non-scalar type: match on field name.
-					if elemType.Kind() == reflect.Pointer {
-						elemType = elemType.Elem()
+					add, subprog, err := c.elemFunc(sf, sf.Type)
+					if err != nil {
+						return err
+					}
+					// Matching word has been removed before being passed to this function.
+					op := func(st *decodeState, rv reflect.Value, words []string) ([]string, error) {
+						return nil, add(st, fieldByIndex(rv, sf.Index), words)
+					}
+					if err := p.addKeywords(p.ops, sf, kws, op); err != nil {
+						return err
 					}
-					subprog, err := programFor(elemType)
+					p.fields = append(p.fields, &field{
+						sf:      sf,
+						kind:    structSliceField,
+						keyword: singular(kws[0]),
+						subprog: subprog,
+					})
+				}
+
+			case reflect.Map:
+				// A map: match on field name, like a slice of structs.
+				// The next word is the key.
+				entry, err := c.entryFunc(sf, sf.Type)
+				if err != nil {
+					return err
+				}
+				op := func(st *decodeState, rv reflect.Value, words []string) ([]string, error) {
+					if len(words) == 0 {
+						return nil, keywordError(st, sf, words, errors.New("missing key"))
+					}
+					return nil, entry(st, fieldByIndex(rv, sf.Index), words)
+				}
+				if err := p.addKeywords(p.ops, sf, kws, op); err != nil {
+					return err
+				}
+				p.fields = append(p.fields, &field{sf: sf, kind: mapField, keyword: singular(kws[0])})
+
+			case reflect.Interface:
+				if isAny(sf.Type) {
+					// An empty interface: match on field name. The words after it
+					// in all the Values that select it form a tree, and the field
+					// holds the tree's value, as for unmarshaling into a *any.
+					op := func(st *decodeState, rv reflect.Value, words []string) ([]string, error) {
+						setAny(fieldByIndex(rv, sf.Index), st.addTree(st.fieldPath(sf), words))
+						return nil, nil
+					}
+					if err := p.addKeywords(p.ops, sf, kws, op); err != nil {
+						return err
+					}
+					p.fields = append(p.fields, &field{sf: sf, kind: anyField, keyword: kws[0]})
+					break
+				}
+				// A single interface: match on field name, like a single struct.
+				op := func(st *decodeState, rv reflect.Value, words []string) ([]string, error) {
+					fv := fieldByIndex(rv, sf.Index)
+					if err := st.checkOccurrence(fv, sf, nil, words); err != nil {
+						return nil, err
+					}
+					t, err := st.variantType(sf, sf.Type, words)
 					if err != nil {
 						return nil, err
 					}
-					// Matching word has been removed before being passed to this function.
-					op := func(rv reflect.Value, words []string) ([]string, error) {
-						fv, err := rv.FieldByIndexErr(sf.Index)
-						if err != nil {
-							// TODO: create the nil pointers.
-							return nil, err
-						}
-						var elem reflect.Value
-						if subprog.idIndex != nil {
-							if len(words) == 0 {
-								return nil, errors.New("no words for struct with ID")
-							}
-							for i := 0; i < fv.Len(); i++ {
-								elem = fv.Index(i)
-								idf, err := elem.FieldByIndexErr(subprog.idIndex)
-								if err != nil {
-									return nil, err
-								}
-								if idf.Interface() == words[0] {
-									break
-								}
-							}
-							if !elem.IsValid() {
-								fv.Set(reflect.Append(fv, reflect.Zero(fv.Type().Elem())))
-								elem = fv.Index(fv.Len() - 1)
-								idf, err := elem.FieldByIndexErr(subprog.idIndex)
-								if err != nil {
-									return nil, err
-								}
-								idf.SetString(words[0])
-							}
-							words = words[1:]
-						} else {
-							fv.Set(reflect.Append(fv, reflect.Zero(fv.Type().Elem())))
-							elem = fv.Index(fv.Len() - 1)
+					defer st.enter(st.fieldPath(sf))()
+					// Later lines of the same occurrence add to the same value.
+					var old reflect.Value
+					if !fv.IsNil() {
+						if fv.Elem().Type() != t {
+							return nil, wordError(sf, sf.Type, words, fmt.Errorf("type differs from %s", fv.Elem().Type()))
 						}
-						return nil, subprog.run(elem, words)
+						old = fv.Elem()
+					}
+					v, err := st.newVariant(sf, t, old, words[1:], true)
+					if err != nil {
+						return nil, err
+					}
+					fv.Set(v)
+					return nil, nil
+				}
+				if err := p.addKeywords(p.ops, sf, kws, op); err != nil {
+					return err
+				}
+				p.fields = append(p.fields, &field{sf: sf, kind: ifaceField, keyword: kws[0]})
+
+			case reflect.Struct, reflect.Pointer:
+				structType := sf.Type
+				if structType.Kind() == reflect.Pointer {
+					structType = structType.Elem()
+				}
+				if structType.Kind() != reflect.Struct {
+					break
+				}
+				subprog, err := c.program(structType)
+				if err != nil {
+					return err
+				}
+				// A single struct: match on field name, like a slice.
+				op := func(st *decodeState, rv reflect.Value, words []string) ([]string, error) {
+					fv := indirect(fieldByIndex(rv, sf.Index))
+					if err := st.checkOccurrence(fv, sf, subprog, words); err != nil {
+						return nil, err
+					}
+					defer st.enter(st.fieldPath(sf))()
+					if subprog.idIndex != nil {
+						fieldByIndex(fv, subprog.idIndex).SetString(words[0])
+						words = words[1:]
+					}
+					if err := subprog.runKeyed(st, fv, words); err != nil {
+						ue := err.(*UnmarshalError)
+						ue.Field = joinPath(sf.Name, ue.Field)
+						return nil, ue
 					}
-					p.ops[sf.Name] = op
-					p.ops[lowerFirst(sf.Name)] = op
+					return nil, nil
 				}
+				if err := p.addKeywords(p.ops, sf, kws, op); err != nil {
+					return err
+				}
+				p.fields = append(p.fields, &field{
+					sf:      sf,
+					kind:    structField,
+					keyword: kws[0],
+					subprog: subprog,
+				})
 			}
 		}
 	}
-	return p, nil
+	p.width = l.next
+	if l.open {
+		p.width = math.MaxInt
+	}
+	for _, f := range p.fields {
+		if f.conflict != nil {
+			p.conflict = f.conflict
+			break
+		}
+	}
+	return nil
+}
+
+// fieldByIndex is like [reflect.Value.FieldByIndex], but it allocates
+// nil pointers to embedded structs along the way.
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 {
+			v = indirect(v)
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// indirect returns v, or if v is a pointer, the value it points to,
+// allocating it if v is nil.
+func indirect(v reflect.Value) reflect.Value {
+	if v.Kind() != reflect.Pointer {
+		return v
+	}
+	if v.IsNil() {
+		v.Set(reflect.New(v.Type().Elem()))
+	}
+	return v.Elem()
+}
+
+// appendElem appends a new element to the slice fv and returns it.
+// If the slice's elements are pointers, the new element is allocated,
+// and the value it points to is returned.
+func appendElem(fv reflect.Value) reflect.Value {
+	fv.Set(reflect.Append(fv, reflect.Zero(fv.Type().Elem())))
+	return indirect(fv.Index(fv.Len() - 1))
+}
+
+// keywordError returns an error for the keyword preceding words,
+// which selected field sf.
+func keywordError(st *decodeState, sf reflect.StructField, words []string, err error) *UnmarshalError {
+	i := len(st.val.Words) - len(words) - 1
+	return &UnmarshalError{Word: st.val.Words[i], Type: sf.Type, Field: sf.Name, Err: err, rest: len(words) + 1}
+}
+
+// fieldPath returns the path of field sf of the struct being unmarshaled.
+// Paths identify fields for the checks that span Values. Unlike addresses,
+// they don't change when a slice holding the struct grows.
+func (st *decodeState) fieldPath(sf reflect.StructField) string {
+	return fmt.Sprintf("%s.%v", st.path, sf.Index)
+}
+
+// forget discards what st has recorded about the fields below path,
+// for a value that has been dropped.
+func (st *decodeState) forget(path string) {
+	below := func(p string) bool {
+		return strings.HasPrefix(p, path+".") || strings.HasPrefix(p, path+"[")
+	}
+	for k := range st.seen {
+		if p, ok := k.(string); ok && below(p) {
+			delete(st.seen, k)
+		}
+	}
+	for p := range st.arrayLens {
+		if below(p) {
+			delete(st.arrayLens, p)
+		}
+	}
+	for p := range st.occurrences {
+		if below(p) {
+			delete(st.occurrences, p)
+		}
+	}
+	for k := range st.trees {
+		if p, ok := k.(string); ok && below(p) {
+			delete(st.trees, k)
+		}
+	}
+}
+
+// suffix returns a Value holding words, a suffix of the words of the Value
+// being unmarshaled, with their positions and tokens.
+func (st *decodeState) suffix(words []string) Value {
+	v := st.val
+	i := len(v.Words) - len(words)
+	s := Value{Words: words, File: v.File, Line: v.Line, Start: v.Start, End: v.End}
+	if len(v.WordPos) == len(v.Words) {
+		s.WordPos = v.WordPos[i:]
+	}
+	if len(v.Tokens) == len(v.Words) {
+		s.Tokens = v.Tokens[i:]
+	}
+	return s
+}
+
+// addTree adds words, a suffix of the words of the Value being unmarshaled,
+// to the tree for key, and returns the tree.
+func (st *decodeState) addTree(key any, words []string) *Node {
+	n := st.trees[key]
+	if n == nil {
+		n = &Node{}
+		st.trees[key] = n
+	}
+	n.add(st.suffix(words))
+	return n
+}
+
+// enter makes path the path of the struct being unmarshaled,
+// and returns a function that restores the previous one.
+func (st *decodeState) enter(path string) func() {
+	old := st.path
+	st.path = path
+	return func() { st.path = old }
+}
+
+// checkRepeat records that the field sf was set by the keyword preceding words.
+// It returns an error if the field was already set by a keyword, unless
+// repeats are allowed.
+func (st *decodeState) checkRepeat(sf reflect.StructField, words []string) error {
+	key := st.fieldPath(sf)
+	pos := st.val.PosOf(len(st.val.Words) - len(words) - 1)
+	if first, ok := st.seen[key]; ok && !st.allowRepeats {
+		return keywordError(st, sf, words, fmt.Errorf("keyword repeated; first occurrence at %s", first))
+	}
+	st.seen[key] = pos
+	return nil
+}
+
+// variantType returns the type registered under the name words[0] for the
+// interface type it, the type of field sf or its elements.
+func (st *decodeState) variantType(sf reflect.StructField, it reflect.Type, words []string) (reflect.Type, error) {
+	if len(words) == 0 {
+		return nil, keywordError(st, sf, words, errors.New("missing type name"))
+	}
+	t := st.types.lookup(it, words[0])
+	if t == nil {
+		return nil, wordError(sf, it, words, fmt.Errorf("%w: no type registered as %q", ErrUnknownKeyword, words[0]))
+	}
+	return t, nil
+}
+
+// newVariant returns a value of type t, a struct or pointer to struct
+// registered for field sf, populated from words.
+// If old is valid, it is the value to add to; otherwise the value is new.
+// If keyed is true, words are unmarshaled as for a single struct,
+// otherwise as for an element of a slice of structs.
+func (st *decodeState) newVariant(sf reflect.StructField, t reflect.Type, old reflect.Value, words []string, keyed bool) (reflect.Value, error) {
+	var v reflect.Value // pointer to the struct
+	switch {
+	case old.IsValid() && t.Kind() == reflect.Pointer:
+		v = old
+	case t.Kind() == reflect.Pointer:
+		v = reflect.New(t.Elem())
+	default:
+		// Values in interfaces aren't addressable, so unmarshal into a copy.
+		v = reflect.New(t)
+		if old.IsValid() {
+			v.Elem().Set(old)
+		}
+	}
+	prog, err := programFor(v.Type().Elem(), st.cfg)
+	if err != nil {
+		return reflect.Value{}, wordError(sf, t, nil, err)
+	}
+	if prog.idIndex != nil {
+		if len(words) == 0 {
+			ue := keywordError(st, sf, words, errors.New("no words for struct with ID"))
+			ue.Type = t
+			return reflect.Value{}, ue
+		}
+		fieldByIndex(v.Elem(), prog.idIndex).SetString(words[0])
+		words = words[1:]
+	}
+	if keyed {
+		err = prog.runKeyed(st, v.Elem(), words)
+	} else {
+		err = prog.run(st, v.Elem(), words)
+	}
+	if err != nil {
+		ue := err.(*UnmarshalError)
+		ue.Field = joinPath(sf.Name, ue.Field)
+		return reflect.Value{}, ue
+	}
+	if t.Kind() == reflect.Pointer {
+		return v, nil
+	}
+	return v.Elem(), nil
+}
+
+// checkOccurrence checks that the keyword preceding words, which selects
+// the struct fv, is part of the same occurrence of the keyword as any before it.
+// The lines of a block are all part of the same occurrence; see [occurrence].
+// If the struct has an ID field, it checks instead that the ID, the first
+// of words, is the same as that of the preceding occurrences.
+func (st *decodeState) checkOccurrence(fv reflect.Value, sf reflect.StructField, subprog *program, words []string) error {
+	key := st.fieldPath(sf)
+	first, seen := st.seen[key]
+	if subprog != nil && subprog.idIndex != nil {
+		if len(words) == 0 {
+			return keywordError(st, sf, words, errors.New("no words for struct with ID"))
+		}
+		if id := fieldByIndex(fv, subprog.idIndex).String(); seen && id != words[0] {
+			return wordError(sf, sf.Type, words, fmt.Errorf("ID differs from %q at %s", id, first))
+		}
+		if !seen {
+			st.seen[key] = st.val.PosOf(len(st.val.Words) - len(words))
+		}
+		return nil
+	}
+	occ := occurrence{file: st.val.File, val: st.nval}
+	if len(st.val.WordPos) > 0 && st.val.WordPos[0].IsValid() {
+		occ = occurrence{file: st.val.File, pos: st.val.WordPos[0]}
+	}
+	if seen && st.occurrences[key] != occ && !st.allowRepeats {
+		return keywordError(st, sf, words, fmt.Errorf("keyword repeated; first occurrence at %s", first))
+	}
+	st.seen[key] = st.val.PosOf(0)
+	st.occurrences[key] = occ
+	return nil
+}
+
+// An entryFunc adds an entry to v, a map, slice or array, from words.
+// For a map, the first word is the key.
+type entryFunc func(st *decodeState, v reflect.Value, words []string) error
+
+// entryFunc returns an entryFunc for the map type t, the type of field sf.
+//
+// A scalar value is set from the single word after the key, and the key
+// may not be repeated. The words after the key are appended to a slice of
+// scalars. A struct value is unmarshaled from the words after the key as
+// for a struct field; if it has an ID field, the ID is the key. Values with
+// the same key add to the same struct.
+func (c *compiler) entryFunc(sf reflect.StructField, t reflect.Type) (entryFunc, error) {
+	if t.Key().Kind() != reflect.String {
+		return nil, fmt.Errorf("map %s must have string keys", t)
+	}
+	et := t.Elem()
+	makeMap := func(m reflect.Value) {
+		if m.IsNil() {
+			m.Set(reflect.MakeMap(t))
+		}
+	}
+	key := func(words []string) reflect.Value {
+		return reflect.ValueOf(words[0]).Convert(t.Key())
+	}
+	// A Value for a top-level map may have no words at all.
+	missingKey := func() error {
+		return wordError(sf, t, nil, errors.New("missing key"))
+	}
+
+	if isAny(et) {
+		// The words after each key form a tree, and the entry holds its value.
+		return func(st *decodeState, m reflect.Value, words []string) error {
+			if len(words) == 0 {
+				return missingKey()
+			}
+			makeMap(m)
+			v := reflect.New(et).Elem()
+			setAny(v, st.addTree(entryKey{m.Pointer(), words[0]}, words[1:]))
+			m.SetMapIndex(key(words), v)
+			return nil
+		}, nil
+	}
+
+	if setf := setScalarFunc(et, c.cfg); setf != nil {
+		return func(st *decodeState, m reflect.Value, words []string) error {
+			if len(words) == 0 {
+				return missingKey()
+			}
+			if len(words) != 2 {
+				return wordError(sf, t, words, fmt.Errorf("want one word after key, got %d", len(words)-1))
+			}
+			makeMap(m)
+			ek := entryKey{m.Pointer(), words[0]}
+			pos := st.val.PosOf(len(st.val.Words) - len(words))
+			if first, ok := st.seen[ek]; ok && !st.allowRepeats {
+				return wordError(sf, t, words, fmt.Errorf("key repeated; first occurrence at %s", first))
+			}
+			st.seen[ek] = pos
+			v := reflect.New(et).Elem()
+			if err := setf(v, words[1]); err != nil {
+				return wordError(sf, et, words[1:], err)
+			}
+			m.SetMapIndex(key(words), v)
+			return nil
+		}, nil
+	}
+
+	if et.Kind() == reflect.Slice {
+		if setf := setScalarFunc(et.Elem(), c.cfg); setf != nil {
+			return func(st *decodeState, m reflect.Value, words []string) error {
+				if len(words) == 0 {
+					return missingKey()
+				}
+				makeMap(m)
+				k := key(words)
+				s := m.MapIndex(k)
+				if !s.IsValid() {
+					s = reflect.Zero(et)
+				}
+				for i, w := range words[1:] {
+					e := reflect.New(et.Elem()).Elem()
+					if err := setf(e, w); err != nil {
+						return wordError(sf, et.Elem(), words[1+i:], err)
+					}
+					s = reflect.Append(s, e)
+				}
+				m.SetMapIndex(k, s)
+				return nil
+			}, nil
+		}
+	}
+
+	structType := et
+	if structType.Kind() == reflect.Pointer {
+		structType = structType.Elem()
+	}
+	if structType.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("cannot unmarshal into map values of type %s", et)
+	}
+	subprog, err := c.program(structType)
+	if err != nil {
+		return nil, err
+	}
+	return func(st *decodeState, m reflect.Value, words []string) error {
+		if len(words) == 0 {
+			return missingKey()
+		}
+		makeMap(m)
+		k := key(words)
+		ek := entryKey{m.Pointer(), words[0]}
+		p, ok := st.entries[ek]
+		if !ok {
+			// Start from the existing value, if any.
+			old := m.MapIndex(k)
+			switch {
+			case !old.IsValid() || (old.Kind() == reflect.Pointer && old.IsNil()):
+				p = reflect.New(structType)
+			case old.Kind() == reflect.Pointer:
+				p = old
+			default:
+				p = reflect.New(structType)
+				p.Elem().Set(old)
+			}
+			st.entries[ek] = p
+		}
+		if subprog.idIndex != nil {
+			fieldByIndex(p.Elem(), subprog.idIndex).SetString(words[0])
+		}
+		defer st.enter(fmt.Sprintf("%s[%q]", st.fieldPath(sf), words[0]))()
+		if err := subprog.runKeyed(st, p.Elem(), words[1:]); err != nil {
+			ue := err.(*UnmarshalError)
+			ue.Field = joinPath(sf.Name, ue.Field)
+			return ue
+		}
+		if et.Kind() == reflect.Pointer {
+			m.SetMapIndex(k, p)
+		} else {
+			m.SetMapIndex(k, p.Elem())
+		}
+		return nil
+	}, nil
+}
+
+// elemFunc returns an entryFunc for t, a slice or array of structs or pointers
+// to structs, the type of field sf. It also returns the program for the struct.
+//
+// If the struct has an ID field, the first word is the ID, and words
+// with the same ID add to the same element. Otherwise each call adds
+// a new element, which is unmarshaled from the words by position.
+// Elements are appended to a slice. An array is filled from the start,
+// and is set to zero before its first element is added.
+//
+// If the elements are empty interfaces, each word is an element, with the
+// value it has in a tree, and there is no program.
+func (c *compiler) elemFunc(sf reflect.StructField, t reflect.Type) (entryFunc, *program, error) {
+	if isAny(t.Elem()) {
+		return func(st *decodeState, v reflect.Value, words []string) error {
+			vpath := st.fieldPath(sf)
+			ws := st.suffix(words)
+			for i, w := range words {
+				e, err := st.addElem(sf, vpath, v, words[i:])
+				if err != nil {
+					return err
+				}
+				e.Set(reflect.ValueOf(scalarValue(w, ws.IsQuoted(i))))
+			}
+			return nil
+		}, nil, nil
+	}
+	elemType := t.Elem()
+	if elemType.Kind() == reflect.Pointer {
+		elemType = elemType.Elem()
+	}
+	subprog, err := c.program(elemType)
+	if err != nil {
+		return nil, nil, err
+	}
+	return func(st *decodeState, v reflect.Value, words []string) error {
+		vpath := st.fieldPath(sf)
+		var elem reflect.Value
+		index := -1
+		if subprog.idIndex != nil {
+			if len(words) == 0 {
+				return wordError(sf, elemType, nil, errors.New("no words for struct with ID"))
+			}
+			for i := range st.numElems(vpath, v) {
+				e := v.Index(i)
+				if e.Kind() == reflect.Pointer {
+					if e.IsNil() {
+						continue
+					}
+					e = e.Elem()
+				}
+				if fieldByIndex(e, subprog.idIndex).String() == words[0] {
+					elem, index = e, i
+					break
+				}
+			}
+		}
+		var old reflect.Value // the slice before a new element was added
+		if !elem.IsValid() {
+			old = reflect.New(v.Type()).Elem()
+			old.Set(v)
+			var err error
+			elem, err = st.addElem(sf, vpath, v, words)
+			if err != nil {
+				return err
+			}
+			index = st.numElems(vpath, v) - 1
+			if subprog.idIndex != nil {
+				fieldByIndex(elem, subprog.idIndex).SetString(words[0])
+			}
+		}
+		epath := fmt.Sprintf("%s[%d]", vpath, index)
+		defer st.enter(epath)()
+		if subprog.idIndex != nil {
+			words = words[1:]
+		}
+		if err := subprog.run(st, elem, words); err != nil {
+			if old.IsValid() {
+				// Drop the new element, so that a partial result
+				// holds only what the input says.
+				if v.Kind() == reflect.Array {
+					v.Index(index).SetZero()
+					st.arrayLens[vpath]--
+				} else {
+					v.Set(old)
+				}
+				st.forget(epath)
+			}
+			ue := err.(*UnmarshalError)
+			ue.Field = joinPath(sf.Name, ue.Field)
+			return ue
+		}
+		return nil
+	}, subprog, nil
+}
+
+// numElems returns the number of elements that have been added to v,
+// a slice or array with the given path.
+func (st *decodeState) numElems(path string, v reflect.Value) int {
+	if v.Kind() == reflect.Array {
+		return st.arrayLens[path]
+	}
+	return v.Len()
+}
+
+// addElem adds an element to v, a slice or array with the given path that
+// is the value of field sf, and returns it. If the elements are pointers, the new element is
+// allocated, and the value it points to is returned. It is an error if
+// the array is full; words are those of the element, for the error.
+func (st *decodeState) addElem(sf reflect.StructField, path string, v reflect.Value, words []string) (reflect.Value, error) {
+	if v.Kind() != reflect.Array {
+		return appendElem(v), nil
+	}
+	n, ok := st.arrayLens[path]
+	if !ok {
+		v.SetZero()
+	}
+	if n == v.Len() {
+		return reflect.Value{}, wordError(sf, v.Type(), words, fmt.Errorf("more than %d elements", v.Len()))
+	}
+	st.arrayLens[path] = n + 1
+	return indirect(v.Index(n)), nil
+}
+
+// compilePos sets up sf, a field tagged "pos", to hold the position
+// of the Value from which the struct was first unmarshaled.
+// The field's type must be [Position] or string; a string is formatted
+// as "file:line:col".
+func (p *program) compilePos(sf reflect.StructField) error {
+	if sf.Type != reflect.TypeFor[Position]() && sf.Type.Kind() != reflect.String {
+		return fmt.Errorf("pos field %s must be a Position or string, not %s", sf.Name, sf.Type)
+	}
+	p.posIndexes = append(p.posIndexes, sf.Index)
+	return nil
+}
+
+// setPos sets the pos fields of rv that aren't already set
+// to the position of the Value being unmarshaled.
+func (p *program) setPos(st *decodeState, rv reflect.Value) {
+	for _, index := range p.posIndexes {
+		fv := fieldByIndex(rv, index)
+		if !fv.IsZero() {
+			continue
+		}
+		if fv.Kind() == reflect.String {
+			fv.SetString(formatPos(st.val.File, st.val.Start.Line, st.val.Start.Col))
+		} else {
+			fv.Set(reflect.ValueOf(st.val.Start))
+		}
+	}
+}
+
+// An Unmarshaler is a type that unmarshals itself from words.
+//
+// UnmarshalGDL is passed the words at the positions of a field of the type,
+// or the words after the field's keyword, and the Value they come from,
+// for positions in errors. It returns the words it did not use.
+// It is an error for a field to leave words unused, but a slice
+// of an Unmarshaler type adds elements until all the words are used.
+type Unmarshaler interface {
+	UnmarshalGDL(words []string, pos Value) (rest []string, err error)
+}
+
+var (
+	unmarshalerType     = reflect.TypeFor[Unmarshaler]()
+	textUnmarshalerType = reflect.TypeFor[encoding.TextUnmarshaler]()
+)
+
+// isUnmarshaler reports whether values of type t, or the values
+// they point to, can be unmarshaled by an [Unmarshaler].
+func isUnmarshaler(t reflect.Type) bool {
+	return reflect.PointerTo(t).Implements(unmarshalerType) ||
+		(t.Kind() == reflect.Pointer && t.Implements(unmarshalerType))
+}
+
+// isCustom reports whether t, or its element type if it is a slice,
+// is unmarshaled by an [Unmarshaler] rather than a converter.
+func (c *compiler) isCustom(t reflect.Type) bool {
+	if t.Kind() == reflect.Slice && !isUnmarshaler(t) {
+		t = t.Elem()
+	}
+	return isUnmarshaler(t) && c.cfg.convs.setFunc(t) == nil
+}
+
+// compileCustom sets up sf, whose type or element type is an [Unmarshaler].
+// Like a slice of scalars, it takes the words in its range, by default
+// the rest of them, or the words after its keyword.
+func (p *program) compileCustom(sf reflect.StructField, l *layout, kws []string) error {
+	sp, conflict, err := l.place(sf, -1)
+	if err != nil {
+		return err
+	}
+	isSlice := !isUnmarshaler(sf.Type)
+	// unmarshal unmarshals words into the field and returns the unused ones.
+	unmarshal := func(st *decodeState, rv reflect.Value, words []string) ([]string, error) {
+		fv := fieldByIndex(rv, sf.Index)
+		if !isSlice {
+			return st.unmarshalGDL(sf, fv, words)
+		}
+		// On error, drop the elements added for these words.
+		old := reflect.New(fv.Type()).Elem()
+		old.Set(fv)
+		for len(words) > 0 {
+			rest, err := st.unmarshalGDL(sf, appendElem(fv), words)
+			if err == nil && len(rest) >= len(words) {
+				err = wordError(sf, sf.Type.Elem(), words, errors.New("UnmarshalGDL used no words"))
+			}
+			if err != nil {
+				fv.Set(old)
+				return nil, err
+			}
+			words = rest
+		}
+		return nil, nil
+	}
+	// unused returns an error for the last n of words, which were not used.
+	unused := func(words []string, n int) error {
+		return wordError(sf, sf.Type, words[len(words)-n:], errors.New("word not used by UnmarshalGDL"))
+	}
+	op := func(st *decodeState, rv reflect.Value, words []string) ([]string, error) {
+		n := len(words)
+		if sp.end >= 0 {
+			n = min(n, sp.end-sp.start)
+		}
+		rest, err := unmarshal(st, rv, words[:n])
+		if err != nil {
+			return nil, err
+		}
+		if len(rest) > 0 {
+			return nil, unused(words[:n], len(rest))
+		}
+		return words[n:], nil
+	}
+	if conflict == nil {
+		p.ops[sp.start] = op
+	}
+	keyOp := func(st *decodeState, rv reflect.Value, words []string) ([]string, error) {
+		if !isSlice {
+			if err := st.checkRepeat(sf, words); err != nil {
+				return nil, err
+			}
+		}
+		rest, err := unmarshal(st, rv, words)
+		if err != nil {
+			if len(words) == 0 {
+				// Report the error at the keyword.
+				return nil, keywordError(st, sf, words, err.(*UnmarshalError).Err)
+			}
+			return nil, err
+		}
+		if len(rest) > 0 {
+			return nil, unused(words, len(rest))
+		}
+		return nil, nil
+	}
+	if err := p.addKeywords(p.keyOps, sf, kws, keyOp); err != nil {
+		return err
+	}
+	p.fields = append(p.fields, &field{sf: sf, kind: customField, span: sp, conflict: conflict, keyword: kws[0]})
+	return nil
+}
+
+// unmarshalGDL calls the UnmarshalGDL method of v, part of field sf,
+// allocating v if it is a nil pointer.
+func (st *decodeState) unmarshalGDL(sf reflect.StructField, v reflect.Value, words []string) ([]string, error) {
+	var u Unmarshaler
+	if v.Kind() == reflect.Pointer && v.Type().Implements(unmarshalerType) {
+		u = indirect(v).Addr().Interface().(Unmarshaler)
+	} else {
+		u = v.Addr().Interface().(Unmarshaler)
+	}
+	rest, err := u.UnmarshalGDL(words, st.val)
+	if err != nil {
+		return nil, wordError(sf, v.Type(), words, err)
+	}
+	if len(rest) > len(words) {
+		return nil, wordError(sf, v.Type(), words, errors.New("UnmarshalGDL returned more words than it was given"))
+	}
+	return rest, nil
+}
+
+// compileStatements sets up sf, a field tagged "statements". Each Value whose
+// first word is the name of a type registered for the field's elements is
+// appended to it, so the field holds those Values in order.
+func (p *program) compileStatements(sf reflect.StructField) error {
+	if sf.Type.Kind() != reflect.Slice || sf.Type.Elem().Kind() != reflect.Interface {
+		return fmt.Errorf("statements field %s must be a slice of interfaces, not %s", sf.Name, sf.Type)
+	}
+	if p.stmts != nil {
+		return fmt.Errorf("struct %s has more than one statements field", p.t)
+	}
+	p.stmts = &field{sf: sf, kind: stmtsField}
+	p.stmtsOp = appendVariantOp(sf)
+	p.fields = append(p.fields, p.stmts)
+	return nil
+}
+
+// appendVariantOp returns an op for sf, a slice of interfaces.
+// The op's first word names the registered type of a new element,
+// and its other words are unmarshaled into that element.
+func appendVariantOp(sf reflect.StructField) op {
+	return func(st *decodeState, rv reflect.Value, words []string) ([]string, error) {
+		t, err := st.variantType(sf, sf.Type.Elem(), words)
+		if err != nil {
+			return nil, err
+		}
+		fv := fieldByIndex(rv, sf.Index)
+		epath := fmt.Sprintf("%s[%d]", st.fieldPath(sf), fv.Len())
+		defer st.enter(epath)()
+		v, err := st.newVariant(sf, t, reflect.Value{}, words[1:], false)
+		if err != nil {
+			st.forget(epath)
+			return nil, err
+		}
+		fv.Set(reflect.Append(fv, v))
+		return nil, nil
+	}
+}
+
+// hasTagOption reports whether opt is one of the options
+// after the name in the gdl tag of sf.
+func hasTagOption(sf reflect.StructField, opt string) bool {
+	_, opts, _ := strings.Cut(sf.Tag.Get("gdl"), ",")
+	for _, o := range strings.Split(opts, ",") {
+		if strings.TrimSpace(o) == opt {
+			return true
+		}
+	}
+	return false
 }
 
 func idIndex(sfs []reflect.StructField) ([]int, error) {
@@ -289,12 +1594,7 @@ func idIndex(sfs []reflect.StructField) ([]int, error) {
 		return nil, nil
 	}
 	f0 := sfs[0]
-	tag := f0.Tag.Get("gdl")
-	if tag == "" {
-		return nil, nil
-	}
-	_, rest, _ := strings.Cut(tag, ",")
-	if strings.TrimSpace(rest) != "id" {
+	if !hasTagOption(f0, "id") {
 		return nil, nil
 	}
 	if f0.Type.Kind() != reflect.String {
@@ -303,18 +1603,15 @@ func idIndex(sfs []reflect.StructField) ([]int, error) {
 	return f0.Index, nil
 }
 
-func plural(s string) string {
-	if len(s) == 0 {
-		return s
-	}
-	r, _ := utf8.DecodeLastRuneInString(s)
-	switch r {
-	case 's', 'x':
-		return s + "es"
-	default:
-		return s + "s"
+// joinPath joins two parts of a field path with a dot.
+// Either may be empty.
+func joinPath(a, b string) string {
+	if a == "" || b == "" {
+		return a + b
 	}
+	return a + "." + b
 }
+
 func lowerFirst(s string) string {
 	if len(s) == 0 {
 		return s
@@ -324,7 +1621,46 @@ func lowerFirst(s string) string {
 	return string(rs)
 }
 
-func setScalarFunc(t reflect.Type) func(reflect.Value, string) error {
+// setScalarFunc returns a function that sets a value of type t from a word,
+// or nil if t is not a scalar type. Converters in cfg take precedence.
+func setScalarFunc(t reflect.Type, cfg config) func(reflect.Value, string) error {
+	if f := cfg.convs.setFunc(t); f != nil {
+		return f
+	}
+	if t.Kind() != reflect.Pointer && reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		return func(rv reflect.Value, s string) error {
+			return rv.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+		}
+	}
+	switch {
+	case t == durationType:
+		return func(rv reflect.Value, s string) error {
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return err
+			}
+			rv.SetInt(int64(d))
+			return nil
+		}
+	case t == urlType:
+		return func(rv reflect.Value, s string) error {
+			u, err := url.Parse(s)
+			if err != nil {
+				return err
+			}
+			rv.Set(reflect.ValueOf(*u))
+			return nil
+		}
+	case isBytes(t):
+		return func(rv reflect.Value, s string) error {
+			b, err := decodeBytes(s, false)
+			if err != nil {
+				return err
+			}
+			rv.SetBytes(b)
+			return nil
+		}
+	}
 	switch t.Kind() {
 	case reflect.String:
 		return func(rv reflect.Value, s string) error {
@@ -333,8 +1669,9 @@ func setScalarFunc(t reflect.Type) func(reflect.Value, string) error {
 		}
 
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		bits := t.Bits()
 		return func(rv reflect.Value, s string) error {
-			i, err := strconv.ParseInt(s, 10, 64)
+			i, err := parseInt(s, bits)
 			if err != nil {
 				return err
 			}
@@ -343,8 +1680,9 @@ func setScalarFunc(t reflect.Type) func(reflect.Value, string) error {
 		}
 
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		bits := t.Bits()
 		return func(rv reflect.Value, s string) error {
-			i, err := strconv.ParseUint(s, 10, 64)
+			i, err := parseUint(s, bits)
 			if err != nil {
 				return err
 			}
@@ -353,8 +1691,9 @@ func setScalarFunc(t reflect.Type) func(reflect.Value, string) error {
 		}
 
 	case reflect.Float32, reflect.Float64:
+		bits := t.Bits()
 		return func(rv reflect.Value, s string) error {
-			f, err := strconv.ParseFloat(s, 64)
+			f, err := parseFloat(s, bits)
 			if err != nil {
 				return err
 			}
@@ -362,15 +1701,43 @@ func setScalarFunc(t reflect.Type) func(reflect.Value, string) error {
 			return nil
 		}
 
+	case reflect.Complex64, reflect.Complex128:
+		bits := t.Bits()
+		return func(rv reflect.Value, s string) error {
+			c, err := parseComplex(s, bits)
+			if err != nil {
+				return err
+			}
+			rv.SetComplex(c)
+			return nil
+		}
+
 	case reflect.Bool:
 		return func(rv reflect.Value, s string) error {
-			b, err := strconv.ParseBool(s)
+			b, err := parseBool(s, cfg.boolWords)
 			if err != nil {
 				return err
 			}
 			rv.SetBool(b)
 			return nil
 		}
+
+	case reflect.Pointer:
+		// A pointer to a scalar is set to a newly allocated value, so that
+		// a field that was set can be told apart from one that wasn't.
+		setf := setScalarFunc(t.Elem(), cfg)
+		if setf == nil {
+			return nil
+		}
+		return func(rv reflect.Value, s string) error {
+			p := reflect.New(t.Elem())
+			if err := setf(p.Elem(), s); err != nil {
+				return err
+			}
+			rv.Set(p)
+			return nil
+		}
+
 	default:
 		return nil
 	}
@@ -5,6 +5,10 @@
 package gdl
 
 import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
 	"strings"
 	"testing"
 )
@@ -116,3 +120,833 @@ func TestUnmarshalValues(t *testing.T) {
 		}
 	}
 }
+
+func TestUnmarshalValueErrorPosition(t *testing.T) {
+	type thing struct {
+		Count int
+		Sizes []int
+	}
+	type things struct {
+		Things []thing
+	}
+	for _, tc := range []struct {
+		in   string
+		want string
+	}{
+		{"thing x", "test:1:7: *invalid syntax"},
+		{"thing (\n  1 2 y\n)", "test:2:7: *invalid syntax"},
+		{"a\nfoo 1", `test:1:1: cannot unmarshal "a" into gdl.things: unknown keyword`},
+	} {
+		f, err := ParseSyntax("test", []byte(tc.in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		matchError(t, tc.in, UnmarshalValues(f.Values(), &things{}), tc.want)
+	}
+}
+
+func TestUnmarshalError(t *testing.T) {
+	type thing struct {
+		Count int
+		Sizes []int
+	}
+	type things struct {
+		Things []thing
+	}
+	for _, tc := range []struct {
+		in   string
+		want UnmarshalError
+	}{
+		{
+			"thing x",
+			UnmarshalError{File: "test", Line: 1, Column: 7, Word: "x", Type: reflect.TypeFor[int](), Field: "Things.Count"},
+		},
+		{
+			"thing (\n  1 2 y\n)",
+			UnmarshalError{File: "test", Line: 2, Column: 7, Word: "y", Type: reflect.TypeFor[int](), Field: "Things.Sizes"},
+		},
+		{
+			"thing 1; foo",
+			UnmarshalError{File: "test", Line: 1, Column: 10, Word: "foo", Type: reflect.TypeFor[things](), Err: ErrUnknownKeyword},
+		},
+	} {
+		f, err := ParseSyntax("test", []byte(tc.in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = UnmarshalValues(f.Values(), &things{})
+		var ue *UnmarshalError
+		if !errors.As(err, &ue) {
+			t.Fatalf("%q: got %v, want UnmarshalError", tc.in, err)
+		}
+		got := *ue
+		got.rest = 0
+		if tc.want.Err == nil {
+			// A number that didn't parse.
+			var ne *strconv.NumError
+			if !errors.As(err, &ne) {
+				t.Errorf("%q: got %v, want a NumError", tc.in, err)
+			}
+			got.Err = nil
+		} else if !errors.Is(err, tc.want.Err) {
+			t.Errorf("%q: got %v, want %v", tc.in, err, tc.want.Err)
+		}
+		if got != tc.want {
+			t.Errorf("%q:\ngot  %+v\nwant %+v", tc.in, got, tc.want)
+		}
+	}
+}
+
+type goMod struct {
+	Module   string
+	Go       string
+	Requires []Require
+	Excludes []string
+}
+
+func TestUnmarshalKeywords(t *testing.T) {
+	const in = `module example.com/m
+go 1.23
+require m1 v1
+exclude a b
+excludes c
+`
+	vals, err := Parse(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got goMod
+	if err := UnmarshalValues(vals, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := goMod{
+		Module:   "example.com/m",
+		Go:       "1.23",
+		Requires: []Require{{"m1", "v1"}},
+		Excludes: []string{"a", "b", "c"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+// access and tagged have fields that take no positions, because they
+// follow a field that takes the rest of the words. The fields can still
+// be selected by keyword.
+type access struct {
+	Allow []string
+	Deny  []string
+}
+
+type tagged struct {
+	Tags []string
+	Name string
+}
+
+func TestUnmarshalKeywordSlices(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		p    any
+		want any
+	}{
+		{"allow a b\ndeny c\nallow d", &access{}, &access{Allow: []string{"a", "b", "d"}, Deny: []string{"c"}}},
+		{"name n\ntags x y", &tagged{}, &tagged{Tags: []string{"x", "y"}, Name: "n"}},
+	} {
+		vals, err := Parse(tc.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := UnmarshalValues(vals, tc.p); err != nil {
+			t.Fatalf("%q: %v", tc.in, err)
+		}
+		if !reflect.DeepEqual(tc.p, tc.want) {
+			t.Errorf("%q: got %+v, want %+v", tc.in, tc.p, tc.want)
+		}
+	}
+
+	// By position, the fields conflict.
+	f, err := ParseSyntax("test", []byte("a b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	matchError(t, "access", UnmarshalValues(f.Values(), &access{}),
+		`test:1:1: cannot unmarshal "a" into *access: field Deny of *follows field Allow, which takes the rest of the words`)
+}
+
+func TestUnmarshalKeywordsError(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want string
+	}{
+		{"module a\ngo 1\nmodule b", `test:3:1: cannot unmarshal "module" into field Module of type string: keyword repeated; first occurrence at test:1:1`},
+		{"go 1 2", "test:1:1: *want one word after keyword, got 2"},
+		{"go", "test:1:1: *want one word after keyword, got 0"},
+	} {
+		f, err := ParseSyntax("test", []byte(tc.in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		matchError(t, tc.in, UnmarshalValues(f.Values(), &goMod{}), tc.want)
+	}
+}
+
+func TestDecoderAllowRepeatedKeywords(t *testing.T) {
+	d := NewDecoder(strings.NewReader("module a\nmodule b\n"))
+	d.AllowRepeatedKeywords()
+	var got goMod
+	if err := d.Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Module != "b" {
+		t.Errorf("got %q, want %q", got.Module, "b")
+	}
+}
+
+type tlsConfig struct {
+	Cert, Key string
+}
+
+type serverConfig struct {
+	Host string
+	Port int
+	TLS  *tlsConfig
+}
+
+type database struct {
+	Name string `gdl:",id"`
+	User string
+}
+
+type appConfig struct {
+	Server   serverConfig
+	Database *database
+	Logging  *struct{ Level string }
+}
+
+func TestUnmarshalStructFields(t *testing.T) {
+	const in = `server (
+	host example.com
+	port 8080
+	TLS (
+		cert c.pem
+		key k.pem
+	)
+)
+database main user bob
+logging
+`
+	vals, err := Parse(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got appConfig
+	if err := UnmarshalValues(vals, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := appConfig{
+		Server: serverConfig{
+			Host: "example.com",
+			Port: 8080,
+			TLS:  &tlsConfig{Cert: "c.pem", Key: "k.pem"},
+		},
+		Database: &database{Name: "main", User: "bob"},
+		Logging:  &struct{ Level string }{},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestUnmarshalStructFieldsError(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want string
+	}{
+		{"server host a\nserver port 1", `test:2:1: cannot unmarshal "server" into field Server of type gdl.serverConfig: keyword repeated; first occurrence at test:1:1`},
+		{"server (host a; host b)", "test:1:17: *field Server.Host*keyword repeated; first occurrence at test:1:9"},
+		{"server port x", "test:1:13: *field Server.Port of type int*"},
+		{"database a user x\ndatabase b", "test:2:10: *ID differs from \"a\" at test:1:10"},
+		{"database", "test:1:1: *no words for struct with ID"},
+	} {
+		f, err := ParseSyntax("test", []byte(tc.in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		matchError(t, tc.in, UnmarshalValues(f.Values(), &appConfig{}), tc.want)
+	}
+
+	// Without positions, each Value is a separate occurrence.
+	vals := []Value{
+		{Words: []string{"server", "host", "a"}},
+		{Words: []string{"server", "port", "1"}},
+	}
+	matchError(t, "no positions", UnmarshalValues(vals, &appConfig{}), "*field Server*keyword repeated*")
+}
+
+func TestUnmarshalRepeatInGrownSlice(t *testing.T) {
+	// The elements of Commands move as the slice grows,
+	// but a repeated keyword is still detected.
+	type opts struct{ X int }
+	type cmd struct {
+		Name string `gdl:",id"`
+		Opts opts
+	}
+	type config struct{ Commands []cmd }
+	f, err := ParseSyntax("test", []byte("command a opts x 1\ncommand b\ncommand c\ncommand a opts x 2\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	matchError(t, "grown", UnmarshalValues(f.Values(), &config{}), "test:4:11: *field Commands.Opts*keyword repeated; first occurrence at test:1:1")
+}
+
+func TestUnmarshalStructFieldsMerge(t *testing.T) {
+	var got appConfig
+	// Without an ID, a repeated struct is merged only if repeats are allowed.
+	d := NewDecoder(strings.NewReader("database main user bob\ndatabase main\nserver host a\nserver port 1\n"))
+	d.AllowRepeatedKeywords()
+	if err := d.Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	want := appConfig{
+		Server:   serverConfig{Host: "a", Port: 1},
+		Database: &database{Name: "main", User: "bob"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+type Leveled struct {
+	Level *int
+}
+
+func TestUnmarshalPointers(t *testing.T) {
+	type opt struct {
+		Name  *string
+		Count *int
+	}
+	type config struct {
+		*Leveled
+		Module   *string
+		Server   *serverConfig
+		Requires []*Require
+		Opts     []opt
+		Tags     []*string
+	}
+	vals, err := Parse(`module m
+level 3
+server host h
+require m1 v1
+require m2 v2
+opt x
+opt y 0
+tags a b
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got config
+	if err := UnmarshalValues(vals, &got); err != nil {
+		t.Fatal(err)
+	}
+	ptr := func(s string) *string { return &s }
+	zero := 0
+	want := config{
+		Leveled:  &Leveled{Level: new(int)},
+		Module:   ptr("m"),
+		Server:   &serverConfig{Host: "h"},
+		Requires: []*Require{{"m1", "v1"}, {"m2", "v2"}},
+		Opts:     []opt{{Name: ptr("x")}, {Name: ptr("y"), Count: &zero}},
+		Tags:     []*string{ptr("a"), ptr("b")},
+	}
+	*want.Level = 3
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestUnmarshalEmbedded(t *testing.T) {
+	type service struct {
+		Metadata
+		*Timeouts
+		Port int
+	}
+	type services struct {
+		Services []service
+	}
+	vals, err := Parse("service web bob 10 80\nservice db alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got services
+	if err := UnmarshalValues(vals, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := services{Services: []service{
+		{Metadata{"web", "bob"}, &Timeouts{10}, 80},
+		{Metadata: Metadata{"db", "alice"}},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	// Promoted fields are selected by keyword like any other.
+	type top struct {
+		Metadata
+		Retry *Retry
+	}
+	vals, err = Parse("name x\nretry attempts 3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got2 top
+	if err := UnmarshalValues(vals, &got2); err != nil {
+		t.Fatal(err)
+	}
+	want2 := top{Metadata{Name: "x"}, &Retry{Attempts: 3}}
+	if !reflect.DeepEqual(got2, want2) {
+		t.Errorf("got %+v, want %+v", got2, want2)
+	}
+}
+
+type menuItem struct {
+	Label string `gdl:",id"`
+	Items []menuItem
+}
+
+type menu struct {
+	Items []menuItem
+}
+
+type node struct {
+	Name     string
+	Children []*node
+	Next     *node
+}
+
+func TestUnmarshalRecursive(t *testing.T) {
+	const in = `item File (
+	item New
+	item Open (
+		item Recent (
+			item a.txt
+		)
+	)
+)
+item Edit
+`
+	vals, err := Parse(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got menu
+	if err := UnmarshalValues(vals, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := menu{Items: []menuItem{
+		{Label: "File", Items: []menuItem{
+			{Label: "New"},
+			{Label: "Open", Items: []menuItem{
+				{Label: "Recent", Items: []menuItem{{Label: "a.txt"}}},
+			}},
+		}},
+		{Label: "Edit"},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	// Mutually recursive through pointers and single struct fields.
+	var n node
+	if err := UnmarshalValue(Value{Words: strings.Fields("root children a children b next c")}, &n); err != nil {
+		t.Fatal(err)
+	}
+	wantNode := node{Name: "root", Children: []*node{{Name: "a", Children: []*node{{Name: "b", Next: &node{Name: "c"}}}}}}
+	if !reflect.DeepEqual(n, wantNode) {
+		t.Errorf("got %+v, want %+v", n, wantNode)
+	}
+}
+
+type cluster struct {
+	Name      string
+	Databases map[string]database
+	Hosts     map[string]*serverConfig
+	Env       map[string]string
+	Groups    map[string][]string
+}
+
+func TestUnmarshalMapFields(t *testing.T) {
+	const in = `name prod
+database main user bob
+database (
+	logs user alice
+	main
+)
+host web1 (
+	host 10.0.0.1
+	port 80
+)
+host web1 TLS cert c.pem
+env (
+	HOME /root
+	PATH /bin
+)
+group admins alice bob
+group admins carol
+`
+	vals, err := Parse(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got cluster
+	if err := UnmarshalValues(vals, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := cluster{
+		Name: "prod",
+		Databases: map[string]database{
+			"main": {Name: "main", User: "bob"},
+			"logs": {Name: "logs", User: "alice"},
+		},
+		Hosts:  map[string]*serverConfig{"web1": {Host: "10.0.0.1", Port: 80, TLS: &tlsConfig{Cert: "c.pem"}}},
+		Env:    map[string]string{"HOME": "/root", "PATH": "/bin"},
+		Groups: map[string][]string{"admins": {"alice", "bob", "carol"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestUnmarshalMaps(t *testing.T) {
+	check := func(in string, p, want any) {
+		t.Helper()
+		vals, err := Parse(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := UnmarshalValues(vals, p); err != nil {
+			t.Fatalf("%q: %v", in, err)
+		}
+		if got := reflect.ValueOf(p).Elem().Interface(); !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: got %+v, want %+v", in, got, want)
+		}
+	}
+	check("a 1\nb 2", &map[string]int{}, map[string]int{"a": 1, "b": 2})
+	check("PATH /bin /usr/bin\nPATH /sbin", new(map[string][]string), map[string][]string{"PATH": {"/bin", "/usr/bin", "/sbin"}})
+	type req struct {
+		Path    string `gdl:",id"`
+		Version string
+	}
+	check("m1 v1\nm2 v2", new(map[string]req), map[string]req{"m1": {"m1", "v1"}, "m2": {"m2", "v2"}})
+	check("main user bob\nlogs (user alice)", new(map[string]*database), map[string]*database{
+		"main": {Name: "main", User: "bob"},
+		"logs": {Name: "logs", User: "alice"},
+	})
+}
+
+func TestUnmarshalMapsError(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		p    any
+		want string
+	}{
+		{"a 1 2", new(map[string]int), `test:1:1: cannot unmarshal "a" into map*int: want one word after key, got 2`},
+		{"a x", new(map[string]int), `test:1:3: cannot unmarshal "x" into int*`},
+		{"a 1\na 2", new(map[string]int), `test:2:1: *key repeated; first occurrence at test:1:1`},
+		{"env HOME", &cluster{}, `test:1:5: cannot unmarshal "HOME" into field Env of type map*string: want one word after key, got 0`},
+		{"env", &cluster{}, `test:1:1: *field Env*missing key`},
+		{"host h port x", &cluster{}, `test:1:13: *field Hosts.Port of type int*`},
+		{"a 1", new(map[int]int), "map*must have string keys"},
+		{"a 1", new(map[string]chan int), "cannot unmarshal into map values of type chan int"},
+	} {
+		f, err := ParseSyntax("test", []byte(tc.in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		matchError(t, tc.in, UnmarshalValues(f.Values(), tc.p), tc.want)
+	}
+
+	// A Value with no words has no key.
+	for _, p := range []any{new(map[string]int), new(map[string][]string), new(map[string]Require)} {
+		var ue *UnmarshalError
+		if err := UnmarshalValues([]Value{{}}, p); !errors.As(err, &ue) || ue.Err.Error() != "missing key" {
+			t.Errorf("%T: got %v, want missing key", p, err)
+		}
+	}
+}
+
+// The pos fields don't take words by position.
+type located struct {
+	Pos     Position `gdl:",pos"`
+	Path    string
+	Version string
+	Where   string `gdl:",pos"`
+}
+
+func TestUnmarshalSlices(t *testing.T) {
+	const in = "m1 v1\nm2 v2\n"
+	f, err := ParseSyntax("test", []byte(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vals := f.Values()
+	want := []Require{{"m1", "v1"}, {"m2", "v2"}}
+
+	var s []Require
+	if err := UnmarshalValues(vals, &s); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(s, want) {
+		t.Errorf("slice: got %+v, want %+v", s, want)
+	}
+
+	var ps []*Require
+	if err := UnmarshalValues(vals, &ps); err != nil {
+		t.Fatal(err)
+	}
+	if len(ps) != 2 || *ps[0] != want[0] || *ps[1] != want[1] {
+		t.Errorf("slice of pointers: got %+v, want %+v", ps, want)
+	}
+
+	a := [3]Require{{"x", "y"}, {"x", "y"}, {"x", "y"}}
+	if err := UnmarshalValues(vals, &a); err != nil {
+		t.Fatal(err)
+	}
+	if wantA := [3]Require{want[0], want[1], {}}; a != wantA {
+		t.Errorf("array: got %+v, want %+v", a, wantA)
+	}
+
+	var a1 [1]Require
+	matchError(t, "array overflow", UnmarshalValues(vals, &a1), `test:2:1: cannot unmarshal "m2" into *1]gdl.Require: more than 1 elements`)
+
+	// Elements with the same ID are merged.
+	var dbs []database
+	d := NewDecoder(strings.NewReader("main\nlogs alice\nmain bob\n"))
+	if err := d.Decode(&dbs); err != nil {
+		t.Fatal(err)
+	}
+	if wantDBs := []database{{"main", "bob"}, {"logs", "alice"}}; !reflect.DeepEqual(dbs, wantDBs) {
+		t.Errorf("IDs: got %+v, want %+v", dbs, wantDBs)
+	}
+
+	// Elements can record their positions.
+	var locs []located
+	if err := UnmarshalValues(vals, &locs); err != nil {
+		t.Fatal(err)
+	}
+	for i, l := range locs {
+		if l.Pos.Line != i+1 || l.Pos.Col != 1 || l.Where != fmt.Sprintf("test:%d:1", i+1) || l.Version != want[i].Version {
+			t.Errorf("element %d: got position %v, %q", i, l.Pos, l.Where)
+		}
+	}
+}
+
+type replace struct {
+	From string `gdl:"1"`
+	To   string `gdl:"3"`
+}
+
+type positional struct {
+	Name    string
+	Version [3]int
+	Tags    []string `gdl:"5-6"`
+	Skip    string   `gdl:"-"`
+	Rest    []string `gdl:"8-"`
+}
+
+func TestUnmarshalPositions(t *testing.T) {
+	type enum struct {
+		Values []string `gdl:"*"`
+		Name   string   `gdl:"1"`
+	}
+	for _, tc := range []struct {
+		in   string
+		p    any
+		want any
+	}{
+		{"a -> b", &replace{}, &replace{"a", "b"}},
+		{"a", &replace{}, &replace{From: "a"}},
+		{"m 1 2 3 x y z r s", &positional{}, &positional{"m", [3]int{1, 2, 3}, []string{"x", "y"}, "", []string{"r", "s"}}},
+		{"m 1 2 3 x", &positional{}, &positional{Name: "m", Version: [3]int{1, 2, 3}, Tags: []string{"x"}}},
+	} {
+		if err := UnmarshalValue(Value{Words: strings.Fields(tc.in)}, tc.p); err != nil {
+			t.Fatalf("%q: %v", tc.in, err)
+		}
+		if !reflect.DeepEqual(tc.p, tc.want) {
+			t.Errorf("%q: got %+v, want %+v", tc.in, tc.p, tc.want)
+		}
+	}
+
+	// "*" is relative to the previous field, so it must come after it.
+	if err := UnmarshalValue(Value{Words: []string{"E", "a"}}, &enum{}); err == nil {
+		t.Error("enum: got nil, want error")
+	}
+
+	// By keyword, an array takes exactly its length.
+	var p positional
+	vals, err := Parse("version 1 2 3\ntags a b c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := UnmarshalValues(vals, &p); err != nil {
+		t.Fatal(err)
+	}
+	if want := (positional{Version: [3]int{1, 2, 3}, Tags: []string{"a", "b", "c"}}); !reflect.DeepEqual(p, want) {
+		t.Errorf("keywords: got %+v, want %+v", p, want)
+	}
+}
+
+func TestUnmarshalPositionsError(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		p    any
+		want string
+	}{
+		{"m 1 2", &positional{}, `test:1:3: cannot unmarshal "1" into field Version of type *3]int: want 3 words, got 2`},
+		{"m 1 x 3", &positional{}, `test:1:5: cannot unmarshal "x" into field Version of type int*`},
+		{"version 1 2", &positional{}, `test:1:1: *want 3 words after keyword, got 2`},
+		{"x", &struct {
+			A string `gdl:"0"`
+		}{}, "field A*bad position \"0\""},
+		{"x", &struct {
+			A string `gdl:"2-1"`
+		}{}, "bad position"},
+		{"x", &struct {
+			A string `gdl:"1-2"`
+		}{}, "range \"1-2\" must have 1 positions"},
+		{"x", &struct {
+			A []string `gdl:"1"`
+		}{}, "position \"1\" of a slice must be a range"},
+		{"x", &struct {
+			A string `gdl:"*"`
+		}{}, "only for slices"},
+		{"x", &struct {
+			A [2]Require
+		}{}, "field A of *: array element type gdl.Require is not a scalar"},
+		{"a x", &struct {
+			A [2]chan int
+		}{}, "field A of *: array element type chan int is not a scalar"},
+		{"x", &struct {
+			A []string
+			B string
+		}{}, "field B*follows field A, which takes the rest of the words"},
+		{"x", &struct {
+			A string `gdl:"2"`
+			B string `gdl:"1"`
+		}{}, "field B*position 1 is already taken by field A"},
+	} {
+		f, err := ParseSyntax("test", []byte(tc.in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		matchError(t, tc.in, UnmarshalValues(f.Values(), tc.p), tc.want)
+	}
+}
+
+// level is an enum that implements encoding.TextUnmarshaler and encoding.TextMarshaler.
+type level int
+
+const (
+	debug level = iota
+	info
+	warn
+)
+
+var levelNames = []string{"debug", "info", "warn"}
+
+func (l *level) UnmarshalText(b []byte) error {
+	for i, n := range levelNames {
+		if n == string(b) {
+			*l = level(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown level %q", b)
+}
+
+func (l level) MarshalText() ([]byte, error) { return []byte(levelNames[l]), nil }
+
+// constraint is a version constraint like ">= 1.2", or "1.2" for "= 1.2".
+// It implements Unmarshaler and Marshaler.
+type constraint struct {
+	Op, Version string
+}
+
+func (c *constraint) UnmarshalGDL(words []string, _ Value) ([]string, error) {
+	if len(words) == 0 {
+		return nil, errors.New("missing version")
+	}
+	switch words[0] {
+	case "<", "<=", ">", ">=":
+		if len(words) < 2 {
+			return nil, errors.New("missing version")
+		}
+		c.Op, c.Version = words[0], words[1]
+		return words[2:], nil
+	}
+	c.Op, c.Version = "=", words[0]
+	return words[1:], nil
+}
+
+func (c constraint) MarshalGDL() ([]string, error) {
+	if c.Op == "=" {
+		return []string{c.Version}, nil
+	}
+	return []string{c.Op, c.Version}, nil
+}
+
+type dependency struct {
+	Name        string
+	Level       level
+	Constraints []constraint
+}
+
+type pin struct {
+	Name  string
+	Level *level
+	Min   constraint
+}
+
+func TestUnmarshalCustom(t *testing.T) {
+	var dep dependency
+	if err := UnmarshalValue(Value{Words: []string{"d", "warn", ">=", "1.2", "<", "2", "1.5"}}, &dep); err != nil {
+		t.Fatal(err)
+	}
+	want := dependency{"d", warn, []constraint{{">=", "1.2"}, {"<", "2"}, {"=", "1.5"}}}
+	if !reflect.DeepEqual(dep, want) {
+		t.Errorf("got %+v, want %+v", dep, want)
+	}
+
+	// By keyword.
+	vals, err := Parse("level info\nmin >= 3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p pin
+	if err := UnmarshalValues(vals, &p); err != nil {
+		t.Fatal(err)
+	}
+	l := info
+	if want := (pin{Level: &l, Min: constraint{">=", "3"}}); !reflect.DeepEqual(p, want) {
+		t.Errorf("got %+v, want %+v", p, want)
+	}
+}
+
+func TestUnmarshalCustomError(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		p    any
+		want string
+	}{
+		{"d loud", &dependency{}, `test:1:3: cannot unmarshal "loud" into field Level of type gdl.level: unknown level "loud"`},
+		{"d info >=", &dependency{}, `test:1:8: cannot unmarshal ">=" into field Constraints of type gdl.constraint: missing version`},
+		{"p info 1 2", &pin{}, `test:1:10: cannot unmarshal "2" into field Min of type gdl.constraint: word not used by UnmarshalGDL`},
+		{"min", &pin{}, `test:1:1: cannot unmarshal "min" into field Min of type gdl.constraint: missing version`},
+	} {
+		f, err := ParseSyntax("test", []byte(tc.in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		matchError(t, tc.in, UnmarshalValues(f.Values(), tc.p), tc.want)
+	}
+}